@@ -2,112 +2,500 @@ package srchway
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
-func ExtractGz(inFilePath string) (outFilePath string, err error) {
-	inFile, err := os.Open(inFilePath)
-	if err != nil {
-		return
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc readCloser) Close() error {
+	return rc.close()
+}
+
+// NewDecompressReader detects the compression of r (gzip, zstd, xz, bzip2 or none) by its
+// magic bytes and returns a reader over the decompressed data.
+func NewDecompressReader(r io.Reader) (rc io.ReadCloser, err error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(6)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(br)
+		if err != nil {
+			return
+		}
+		rc = gz
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		var zr *zstd.Decoder
+		zr, err = zstd.NewReader(br)
+		if err != nil {
+			return
+		}
+		rc = readCloser{zr, func() error { zr.Close(); return nil }}
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		var xr *xz.Reader
+		xr, err = xz.NewReader(br)
+		if err != nil {
+			return
+		}
+		rc = ioutil.NopCloser(xr)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		rc = ioutil.NopCloser(bzip2.NewReader(br))
+	default:
+		rc = ioutil.NopCloser(br)
 	}
-	defer inFile.Close()
+	return
+}
 
-	outFilePath = strings.TrimSuffix(inFilePath, ".gz")
-	outFile, err := os.Create(outFilePath)
-	if err != nil {
-		return
+// ExtractLimits bounds what is extracted from an archive.
+type ExtractLimits struct {
+	MaxFiles int
+	MaxBytes int64
+}
+
+// DefaultExtractLimits is generous for PKGBUILD snapshots but stops archive bombs.
+var DefaultExtractLimits = ExtractLimits{MaxFiles: 10000, MaxBytes: 512 << 20}
+
+// UnsafeEntry is an archive entry which was not extracted.
+type UnsafeEntry struct {
+	Name   string
+	Reason string
+}
+
+// UnsafeArchiveError lists the entries of an archive which were refused
+// (e.g. escaping the output directory or exceeding the limits).
+type UnsafeArchiveError struct {
+	Entries []UnsafeEntry
+}
+
+func (e *UnsafeArchiveError) Error() string {
+	ss := make([]string, 0, len(e.Entries))
+	for _, entry := range e.Entries {
+		ss = append(ss, entry.Name+" ("+entry.Reason+")")
 	}
-	defer outFile.Close()
+	return "unsafe archive entries: " + strings.Join(ss, ", ")
+}
 
-	reader, err := gzip.NewReader(inFile)
-	if err != nil {
-		return
+// TarExtractor extracts tar entries under Root, refusing entries which would
+// write outside of it (absolute or ".." paths, escaping links, paths through links).
+type TarExtractor struct {
+	Root   string
+	Limits ExtractLimits
+	// StripComponents leading path components are dropped from entry names; entries
+	// with fewer components are skipped.
+	StripComponents int
+	// Normalize replaces the modes of the archive with 0644 or 0755 (for directories and
+	// executable files) and the modification times with NormalizedModTime.
+	Normalize bool
+	files     int
+	bytes     int64
+	limited   bool
+	unsafe    []UnsafeEntry
+	dirs      map[string]dirMeta
+}
+
+// dirMeta is the mode and modification time set on a directory once it is complete.
+type dirMeta struct {
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// NormalizedModTime is the modification time of the files extracted with Normalize.
+var NormalizedModTime = time.Unix(0, 0)
+
+func NewTarExtractor(root string) *TarExtractor {
+	return &TarExtractor{Root: root, Limits: DefaultExtractLimits}
+}
+
+// fileMode returns the permissions to give to the entry of header.
+func (x *TarExtractor) fileMode(header *tar.Header) os.FileMode {
+	mode := header.FileInfo().Mode().Perm()
+	if !x.Normalize {
+		return mode
+	}
+	if header.Typeflag == tar.TypeDir || mode&0111 != 0 {
+		return 0755
 	}
-	defer reader.Close()
+	return 0644
+}
+
+// modTime returns the modification time to give to the entry of header.
+func (x *TarExtractor) modTime(header *tar.Header) time.Time {
+	if x.Normalize {
+		return NormalizedModTime
+	}
+	return header.ModTime
+}
+
+// cleanEntryPath returns the slash-separated path of name relative to the root,
+// or "" if it is absolute or escapes the root.
+func cleanEntryPath(name string) string {
+	if path.IsAbs(name) {
+		return ""
+	}
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return ""
+	}
+	return clean
+}
 
-	_, err = io.Copy(outFile, reader)
+// strip drops the first x.StripComponents components of the clean path rel,
+// returning "." if nothing is left.
+func (x *TarExtractor) strip(rel string) string {
+	parts := strings.Split(rel, "/")
+	if rel == "." || len(parts) <= x.StripComponents {
+		return "."
+	}
+	return strings.Join(parts[x.StripComponents:], "/")
+}
+
+// MaxSymlinkHops bounds the symbolic links followed when resolving a link target (like Linux).
+const MaxSymlinkHops = 40
+
+// linkStaysInside reports whether a symbolic link at rel to linkname resolves inside the root.
+// The target is resolved one component at a time through the links already extracted, so that
+// chains like "a/s -> ../.." and "a/t -> s/.." cannot escape. ".." is refused after a component
+// which does not exist yet, as a later entry could make it a link to another directory; links
+// existing at any point are checked when created, so they never change afterwards.
+func (x *TarExtractor) linkStaysInside(rel string, linkname string) bool {
+	if path.IsAbs(linkname) {
+		return false
+	}
+	var stack []string
+	if dir := path.Dir(rel); dir != "." {
+		stack = strings.Split(dir, "/")
+	}
+	pending := strings.Split(linkname, "/")
+	missing := false
+	hops := 0
+	for len(pending) != 0 {
+		part := pending[0]
+		pending = pending[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if missing || len(stack) == 0 {
+				return false
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		stack = append(stack, part)
+		if missing {
+			continue
+		}
+		itemPath := filepath.Join(x.Root, filepath.FromSlash(strings.Join(stack, "/")))
+		info, err := os.Lstat(itemPath)
+		if err != nil {
+			missing = true
+			continue
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		hops++
+		target, err := os.Readlink(itemPath)
+		if err != nil || hops > MaxSymlinkHops || path.IsAbs(target) {
+			return false
+		}
+		// continue from the directory of the link with its target
+		stack = stack[:len(stack)-1]
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+	return true
+}
+
+// checkParents ensures that no parent directory of rel under the root is a symbolic link,
+// so that nothing is written through a link created by an earlier entry.
+func (x *TarExtractor) checkParents(rel string) (reason string) {
+	dir := x.Root
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return
+		}
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "path through a symbolic link"
+		}
+	}
 	return
 }
 
-func ExtractAndRemoveGz(inFilePath string) (outFilePath string, err error) {
-	outFilePath, err = ExtractGz(inFilePath)
-	if err != nil {
-		return
+// mkdirParents creates the missing parent directories of rel. They get the mode 0755
+// (whatever the umask) and, with Normalize, NormalizedModTime.
+func (x *TarExtractor) mkdirParents(rel string) (err error) {
+	dir := x.Root
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		err = os.Mkdir(dir, 0700)
+		if os.IsExist(err) {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		meta := dirMeta{mode: 0755}
+		if x.Normalize {
+			meta.modTime = NormalizedModTime
+		}
+		x.setDirMeta(dir, meta)
 	}
-	err = os.Remove(inFilePath)
 	return
 }
 
-func UnarchiveTarItem(tarReader *tar.Reader, outFilePath string) (itemPath string, err error) {
-	header, err := tarReader.Next()
-	if err != nil {
-		return
+func (x *TarExtractor) setDirMeta(dir string, meta dirMeta) {
+	if x.dirs == nil {
+		x.dirs = make(map[string]dirMeta)
+	}
+	x.dirs[dir] = meta
+}
+
+// finishDirs sets the modes and modification times of the directories, deepest first,
+// now that nothing is written into them anymore.
+func (x *TarExtractor) finishDirs() (err error) {
+	dirs := make([]string, 0, len(x.dirs))
+	for dir := range x.dirs {
+		dirs = append(dirs, dir)
 	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		meta := x.dirs[dir]
+		err = os.Chmod(dir, meta.mode)
+		if err == nil && !meta.modTime.IsZero() {
+			err = os.Chtimes(dir, meta.modTime, meta.modTime)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
 
-	itemPath = filepath.Join(outFilePath, header.Name)
-	info := header.FileInfo()
+// checkTarget ensures that the existing file at itemPath (if any) is not a symbolic link.
+func checkTarget(itemPath string) (reason string) {
+	info, err := os.Lstat(itemPath)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "overwrites a symbolic link"
+	}
+	return
+}
 
-	if info.IsDir() {
-		err = os.MkdirAll(itemPath, info.Mode())
+// ExtractItem extracts the entry of header. It returns a non-empty reason (and a nil error)
+// if the entry is refused.
+func (x *TarExtractor) ExtractItem(header *tar.Header, r io.Reader) (reason string, err error) {
+	if header.Typeflag == tar.TypeXGlobalHeader {
+		return
+	}
+	rel := cleanEntryPath(header.Name)
+	if rel == "" {
+		return "path outside of the archive", nil
+	}
+	if rel = x.strip(rel); rel == "." {
+		// the directory stripped to the root (e.g. "<pkgbase>/") gives it its metadata
+		if header.Typeflag == tar.TypeDir {
+			x.setDirMeta(x.Root, dirMeta{mode: x.fileMode(header), modTime: x.modTime(header)})
+		}
 		return
 	}
+	if reason = x.checkParents(rel); reason != "" {
+		return
+	}
+	itemPath := filepath.Join(x.Root, filepath.FromSlash(rel))
+	if x.files >= x.Limits.MaxFiles {
+		x.limited = true
+		return fmt.Sprintf("more than %d entries", x.Limits.MaxFiles), nil
+	}
+	x.files++
+	mode := x.fileMode(header)
+	modTime := x.modTime(header)
 
-	parentDir := path.Dir(itemPath)
-	_ = os.MkdirAll(parentDir, 0755)
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if reason = checkTarget(itemPath); reason != "" {
+			return
+		}
+		err = x.mkdirParents(rel)
+		if err != nil {
+			return
+		}
+		// keep it writable until its content is extracted
+		err = os.Mkdir(itemPath, 0700)
+		if os.IsExist(err) {
+			err = nil
+		}
+		if err == nil {
+			x.setDirMeta(itemPath, dirMeta{mode: mode, modTime: modTime})
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		if reason = checkTarget(itemPath); reason != "" {
+			return
+		}
+		if header.Size > x.Limits.MaxBytes-x.bytes {
+			x.limited = true
+			return fmt.Sprintf("more than %d bytes in total", x.Limits.MaxBytes), nil
+		}
+		err = x.mkdirParents(rel)
+		if err != nil {
+			return
+		}
+		var file *os.File
+		file, err = os.OpenFile(itemPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+		if err != nil {
+			return
+		}
+		var n int64
+		n, err = io.CopyN(file, r, header.Size)
+		x.bytes += n
+		if e := file.Close(); err == nil {
+			err = e
+		}
+		// set explicitly, as OpenFile applies the umask and keeps the mode of existing files
+		if err == nil {
+			err = os.Chmod(itemPath, mode)
+		}
+		if err == nil {
+			err = os.Chtimes(itemPath, modTime, modTime)
+		}
+	case tar.TypeSymlink:
+		if !x.linkStaysInside(rel, header.Linkname) {
+			return "symbolic link to " + header.Linkname + " outside of the archive", nil
+		}
+		if _, e := os.Lstat(itemPath); e == nil {
+			return "already exists", nil
+		}
+		// the modification time of the link itself is not set (there is no portable lutimes)
+		err = x.mkdirParents(rel)
+		if err == nil {
+			err = os.Symlink(header.Linkname, itemPath)
+		}
+	case tar.TypeLink:
+		target := cleanEntryPath(header.Linkname)
+		if target != "" {
+			target = x.strip(target)
+		}
+		if target == "" || target == "." {
+			return "hard link to " + header.Linkname + " outside of the archive", nil
+		}
+		if reason = x.checkParents(target); reason != "" {
+			return
+		}
+		targetPath := filepath.Join(x.Root, filepath.FromSlash(target))
+		info, e := os.Lstat(targetPath)
+		if e != nil || !info.Mode().IsRegular() {
+			return "hard link to " + header.Linkname + " which is not an extracted file", nil
+		}
+		if _, e := os.Lstat(itemPath); e == nil {
+			return "already exists", nil
+		}
+		err = x.mkdirParents(rel)
+		if err == nil {
+			err = os.Link(targetPath, itemPath)
+		}
+	default:
+		reason = fmt.Sprintf("unsupported entry type %q", header.Typeflag)
+	}
+	return
+}
 
-	file, err := os.OpenFile(itemPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+// Extract extracts every entry of tarReader. Refused entries are skipped and reported
+// together as an *UnsafeArchiveError; extraction stops once a limit is exceeded.
+func (x *TarExtractor) Extract(tarReader *tar.Reader) (err error) {
+	for {
+		var header *tar.Header
+		header, err = tarReader.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+		var reason string
+		reason, err = x.ExtractItem(header, tarReader)
+		if err != nil {
+			return
+		}
+		if reason != "" {
+			x.unsafe = append(x.unsafe, UnsafeEntry{Name: header.Name, Reason: reason})
+			if x.limited {
+				break
+			}
+		}
+	}
+	err = x.finishDirs()
 	if err != nil {
 		return
 	}
-	defer file.Close()
-	_, err = io.Copy(file, tarReader)
+	if len(x.unsafe) != 0 {
+		err = &UnsafeArchiveError{Entries: x.unsafe}
+	}
 	return
 }
 
-func UnarchiveTar(inFilePath string) (outFilePath string, err error) {
-	// http://blog.ralch.com/tutorial/golang-working-with-tar-and-gzip/
-	reader, err := os.Open(inFilePath)
+// ExtractFrom extracts the (possibly compressed) tar archive read from r into x.Root.
+func (x *TarExtractor) ExtractFrom(r io.Reader) (err error) {
+	rc, err := NewDecompressReader(r)
 	if err != nil {
 		return
 	}
-	defer reader.Close()
-	tarReader := tar.NewReader(reader)
-
-	outFilePath = strings.TrimSuffix(inFilePath, ".tar")
-
-	for {
-		itemPath, e := UnarchiveTarItem(tarReader, outFilePath)
-		if e == io.EOF {
-			break
-		} else if e != nil {
-			fmt.Fprintln(os.Stderr, itemPath)
-			fmt.Fprintln(os.Stderr, e)
-			err = e
-		}
+	defer rc.Close()
+	err = os.MkdirAll(x.Root, 0755)
+	if err != nil {
+		return
 	}
+	err = x.Extract(tar.NewReader(rc))
 	return
 }
 
-func UnarchiveAndRemoveTar(inFilePath string) (outFilePath string, err error) {
-	outFilePath, err = UnarchiveTar(inFilePath)
+// ExtractArchiveFile extracts the archive at inFilePath (e.g. a .pkg.tar.zst) into outDir.
+func ExtractArchiveFile(inFilePath string, outDir string) (err error) {
+	file, err := os.Open(inFilePath)
 	if err != nil {
 		return
 	}
-	err = os.Remove(inFilePath)
+	defer file.Close()
+	err = NewTarExtractor(outDir).ExtractFrom(file)
 	return
 }
 
-func ExtractAndRemoveTarGz(inFilePath string) (outFilePath string, err error) {
-	outFilePath, err = ExtractAndRemoveGz(inFilePath)
+// DownloadAndExtract streams the archive at url into destDir without temporary files,
+// dropping the first strip components of every path (like tar --strip-components) and
+// normalizing the metadata if conf.NormalizeFlag is set. destDir is removed on failure.
+func DownloadAndExtract(conf Conf, url string, destDir string, strip int) (err error) {
+	resp, err := httpGetResponse(conf, url)
 	if err != nil {
 		return
 	}
-	outFilePath, err = UnarchiveAndRemoveTar(outFilePath)
+	defer resp.Body.Close()
+	x := NewTarExtractor(destDir)
+	x.StripComponents = strip
+	x.Normalize = conf.NormalizeFlag
+	err = x.ExtractFrom(resp.Body)
+	if err != nil {
+		os.RemoveAll(destDir)
+	}
 	return
 }
@@ -0,0 +1,309 @@
+package srchway
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type tarEntry struct {
+	name    string
+	typ     byte
+	link    string
+	body    string
+	mode    int64
+	modTime time.Time
+}
+
+func tarFile(name string, body string) tarEntry {
+	return tarEntry{name: name, typ: tar.TypeReg, body: body}
+}
+
+func tarDir(name string) tarEntry {
+	return tarEntry{name: name, typ: tar.TypeDir}
+}
+
+func tarSymlink(name string, link string) tarEntry {
+	return tarEntry{name: name, typ: tar.TypeSymlink, link: link}
+}
+
+func tarHardlink(name string, link string) tarEntry {
+	return tarEntry{name: name, typ: tar.TypeLink, link: link}
+}
+
+func buildTar(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Typeflag: e.typ, Linkname: e.link, Mode: 0644, Size: int64(len(e.body))}
+		switch {
+		case e.mode != 0:
+			header.Mode = e.mode
+		case e.typ == tar.TypeDir:
+			header.Mode = 0755
+		}
+		header.ModTime = e.modTime
+		switch e.typ {
+		case tar.TypeXGlobalHeader:
+			header = &tar.Header{Typeflag: e.typ, PAXRecords: map[string]string{"comment": "0123456789abcdef"}}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(buildTar(t, entries...))
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// extract extracts entries into <tmp>/root and returns the root and the refused entry names.
+func extract(t *testing.T, limits ExtractLimits, entries ...tarEntry) (root string, refused []string) {
+	t.Helper()
+	root = filepath.Join(t.TempDir(), "root")
+	x := NewTarExtractor(root)
+	x.Limits = limits
+	err := x.ExtractFrom(bytes.NewReader(buildTar(t, entries...)))
+	var unsafeErr *UnsafeArchiveError
+	if err != nil && !errors.As(err, &unsafeErr) {
+		t.Fatal(err)
+	}
+	if unsafeErr != nil {
+		for _, entry := range unsafeErr.Entries {
+			refused = append(refused, entry.Name)
+		}
+	}
+	// nothing may be created next to the root
+	siblings, _ := os.ReadDir(filepath.Dir(root))
+	if len(siblings) != 1 {
+		t.Errorf("entries were written outside of the root: %v", siblings)
+	}
+	return
+}
+
+func TestExtractRefusesUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		desc    string
+		entries []tarEntry
+		refused []string
+	}{
+		{"parent", []tarEntry{tarFile("../evil", "x")}, []string{"../evil"}},
+		{"absolute", []tarEntry{tarFile("/tmp/evil", "x")}, []string{"/tmp/evil"}},
+		{"dotdot inside", []tarEntry{tarFile("a/../../evil", "x")}, []string{"a/../../evil"}},
+		{"absolute link", []tarEntry{tarSymlink("s", "/etc")}, []string{"s"}},
+		{"escaping link", []tarEntry{tarSymlink("a/s", "../../x")}, []string{"a/s"}},
+		{"link chain", []tarEntry{tarDir("a/b/"), tarSymlink("a/b/s", "../.."), tarSymlink("a/b/t", "s/..")}, []string{"a/b/t"}},
+		{"longer link chain", []tarEntry{
+			tarDir("a/b/c/"), tarSymlink("a/b/c/s", ".."), tarSymlink("a/b/c/u", "s/.."), tarSymlink("a/b/c/v", "u/../.."),
+		}, []string{"a/b/c/v"}},
+		{"dotdot after a missing directory", []tarEntry{tarSymlink("a/t", "x/.."), tarSymlink("a/x", ".")}, []string{"a/t"}},
+		{"link loop", []tarEntry{tarSymlink("l1", "l2"), tarSymlink("l2", "l1"), tarSymlink("l3", "l1/..")}, []string{"l3"}},
+		{"write through a link", []tarEntry{tarDir("a/"), tarSymlink("s", "a"), tarFile("s/f", "x")}, []string{"s/f"}},
+		{"overwrite a link", []tarEntry{tarFile("f", "x"), tarSymlink("s", "f"), tarFile("s", "y")}, []string{"s"}},
+		{"link over a link", []tarEntry{tarSymlink("s", "a"), tarSymlink("s", "b")}, []string{"s"}},
+		{"escaping hard link", []tarEntry{tarHardlink("h", "../x")}, []string{"h"}},
+		{"hard link to a link", []tarEntry{tarFile("f", "x"), tarSymlink("s", "f"), tarHardlink("h", "s")}, []string{"h"}},
+		{"hard link to a missing file", []tarEntry{tarHardlink("h", "nothing")}, []string{"h"}},
+		{"hard link through a link", []tarEntry{tarFile("a/f", "x"), tarSymlink("s", "a"), tarHardlink("h", "s/f")}, []string{"h"}},
+		{"device", []tarEntry{{name: "dev", typ: tar.TypeChar}}, []string{"dev"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			root, refused := extract(t, DefaultExtractLimits, tt.entries...)
+			if strings.Join(refused, ",") != strings.Join(tt.refused, ",") {
+				t.Errorf("refused %q, want %q", refused, tt.refused)
+			}
+			for _, name := range tt.refused {
+				if name == "s" || strings.HasPrefix(name, "/") || strings.HasPrefix(name, "..") {
+					continue
+				}
+				if _, err := os.Lstat(filepath.Join(root, name)); err == nil {
+					t.Errorf("%s was extracted", name)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractSafeLinks(t *testing.T) {
+	root, refused := extract(t, DefaultExtractLimits,
+		tarFile("a/b/f", "hello"),
+		tarSymlink("a/s", "b/f"),
+		tarSymlink("a/b/up", ".."),
+		tarSymlink("c/t", "../a/b/up/s"),
+		tarSymlink("self", "."),
+		tarHardlink("a/h", "a/b/f"),
+	)
+	if len(refused) != 0 {
+		t.Fatalf("refused %q", refused)
+	}
+	for _, name := range []string{"a/s", "c/t", "a/h", "self/a/b/f"} {
+		b, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil || string(b) != "hello" {
+			t.Errorf("%s = %q, %v", name, b, err)
+		}
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	root, refused := extract(t, ExtractLimits{MaxFiles: 2, MaxBytes: 1 << 20},
+		tarFile("a", "1"), tarFile("b", "2"), tarFile("c", "3"), tarFile("d", "4"))
+	// extraction stops at the first entry over the limit
+	if strings.Join(refused, ",") != "c" {
+		t.Errorf("MaxFiles: refused %q, want [c]", refused)
+	}
+	if _, err := os.Stat(filepath.Join(root, "d")); err == nil {
+		t.Error("MaxFiles: d was extracted")
+	}
+
+	root, refused = extract(t, ExtractLimits{MaxFiles: 100, MaxBytes: 10},
+		tarFile("a", "123456"), tarFile("b", "1234"), tarFile("c", "1"), tarFile("d", "1"))
+	if strings.Join(refused, ",") != "c" {
+		t.Errorf("MaxBytes: refused %q, want [c]", refused)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "b")); string(b) != "1234" {
+		t.Errorf("MaxBytes: b = %q", b)
+	}
+}
+
+func TestExtractStripComponents(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	x := NewTarExtractor(root)
+	x.StripComponents = 1
+	data := buildTar(t, tarEntry{typ: tar.TypeXGlobalHeader},
+		tarDir("foo/"), tarFile("foo/PKGBUILD", "pkgname=foo"), tarHardlink("foo/h", "foo/PKGBUILD"), tarFile("stray", "x"))
+	if err := x.ExtractFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(root)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, ",") != "PKGBUILD,h" {
+		t.Errorf("extracted %q, want [PKGBUILD h]", names)
+	}
+}
+
+func TestExtractModes(t *testing.T) {
+	// implicit directories get 0755 whatever the umask
+	defer syscall.Umask(syscall.Umask(077))
+	t1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	withMeta := func(e tarEntry, mode int64, modTime time.Time) tarEntry {
+		e.mode, e.modTime = mode, modTime
+		return e
+	}
+	entries := []tarEntry{
+		withMeta(tarDir("pkg/"), 0750, t1),
+		withMeta(tarFile("pkg/PKGBUILD", "pkgname=pkg"), 0644, t2),
+		withMeta(tarFile("pkg/run.sh", "#!/bin/sh"), 0755, t2),
+		withMeta(tarFile("pkg/secret", "x"), 0600, t2),
+		// written into after it is created, so its mode and time are set at the end
+		withMeta(tarDir("pkg/ro/"), 0555, t1),
+		withMeta(tarFile("pkg/ro/f", "x"), 0444, t2),
+		withMeta(tarFile("pkg/a/b/f", "x"), 0640, t2),
+	}
+	tests := []struct {
+		name string
+		// mode and modTime without and with Normalize (a zero time is not checked)
+		mode, normMode       os.FileMode
+		modTime, normModTime time.Time
+	}{
+		{".", 0750, 0755, t1, NormalizedModTime},
+		{"PKGBUILD", 0644, 0644, t2, NormalizedModTime},
+		{"run.sh", 0755, 0755, t2, NormalizedModTime},
+		{"secret", 0600, 0644, t2, NormalizedModTime},
+		{"ro", 0555, 0755, t1, NormalizedModTime},
+		{"ro/f", 0444, 0644, t2, NormalizedModTime},
+		{"a", 0755, 0755, time.Time{}, NormalizedModTime},
+		{"a/b", 0755, 0755, time.Time{}, NormalizedModTime},
+		{"a/b/f", 0640, 0644, t2, NormalizedModTime},
+	}
+	for _, normalize := range []bool{false, true} {
+		root := filepath.Join(t.TempDir(), "root")
+		x := NewTarExtractor(root)
+		x.StripComponents = 1
+		x.Normalize = normalize
+		if err := x.ExtractFrom(bytes.NewReader(buildTar(t, entries...))); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.Chmod(filepath.Join(root, "ro"), 0755) })
+		for _, tt := range tests {
+			mode, modTime := tt.mode, tt.modTime
+			if normalize {
+				mode, modTime = tt.normMode, tt.normModTime
+			}
+			info, err := os.Stat(filepath.Join(root, tt.name))
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			if info.Mode().Perm() != mode {
+				t.Errorf("normalize=%v: %s mode = %v, want %v", normalize, tt.name, info.Mode().Perm(), mode)
+			}
+			if !modTime.IsZero() && !info.ModTime().Equal(modTime) {
+				t.Errorf("normalize=%v: %s modification time = %v, want %v", normalize, tt.name, info.ModTime(), modTime)
+			}
+		}
+	}
+}
+
+func TestNewDecompressReader(t *testing.T) {
+	compressors := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"zstd": func(w io.Writer) io.WriteCloser { zw, _ := zstd.NewWriter(w); return zw },
+		"xz":   func(w io.Writer) io.WriteCloser { xw, _ := xz.NewWriter(w); return xw },
+	}
+	inputs := map[string][]byte{"none": []byte("hello\n")}
+	for name, compressor := range compressors {
+		var buf bytes.Buffer
+		w := compressor(&buf)
+		w.Write([]byte("hello\n"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		inputs[name] = buf.Bytes()
+	}
+	// bzip2.compress(b"hello\n") (the standard library has no bzip2 writer)
+	inputs["bzip2"], _ = hex.DecodeString("425a6839314159265359c1c080e2000001410000100244a00030cd00c3462997177245385090c1c080e2")
+	for name, input := range inputs {
+		rc, err := NewDecompressReader(bytes.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(b) != "hello\n" {
+			t.Errorf("%s: read %q, %v", name, b, err)
+		}
+	}
+}
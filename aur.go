@@ -3,30 +3,38 @@ package srchway
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"path"
-	"regexp"
+	"strings"
 	"time"
 
 	"github.com/fatih/color"
-	shutil "github.com/termie/go-shutil"
 )
 
 const UserBaseURL = "https://aur.archlinux.org"
-const UserRPCURL = UserBaseURL + "/rpc.php"
+const UserRPCPath = "/rpc.php"
+const UserRPCURL = UserBaseURL + UserRPCPath
+const UserRPCVersion = "5"
+
+// UserRepoName is the repository name used for AUR packages.
+const UserRepoName = "aur"
 
 type UserRepo struct {
 }
 
+func (repo UserRepo) BaseURL(conf Conf) string {
+	if conf.UserURL != "" {
+		return strings.TrimSuffix(conf.UserURL, "/")
+	}
+	return UserBaseURL
+}
+
 type UserSearchResponse struct {
 	Version     int
 	Type        string
 	ResultCount int
 	Results     []UserSearchResult
+	Error       string
 }
 
 type UserSearchResult struct {
@@ -38,74 +46,129 @@ type UserSearchResult struct {
 	Description    string
 	URL            string
 	NumVotes       int
+	Popularity     float64
 	OutOfDate      int
 	Maintainer     string
 	FirstSubmitted int
 	LastModified   int
-	License        string
 	URLPath        string
-	CategoryID     int
+	Depends        []string
+	MakeDepends    []string
+	CheckDepends   []string
+	OptDepends     []string
+	Conflicts      []string
+	Provides       []string
+	Replaces       []string
+	Groups         []string
+	License        []string
+	Keywords       []string
+}
+
+func (repo UserRepo) rpc(conf Conf, queryItems []QueryItem) (bytes []byte, err error) {
+	queryItems = append([]QueryItem{{Key: "v", Values: []string{UserRPCVersion}}}, queryItems...)
+	url := repo.BaseURL(conf) + UserRPCPath + "?" + BuildQueryString(queryItems)
+	bytes, err = httpGet(conf, url)
+	return
 }
 
-func (repo UserRepo) Search(conf Conf) (bytes []byte, err error) {
+func (repo UserRepo) SearchRaw(conf Conf) (bytes []byte, err error) {
+	queryItems := []QueryItem{{Key: "type", Values: []string{"search"}}}
+	switch conf.SearchBy {
+	case "":
+	case "desc":
+		err = errors.New("the AUR cannot be searched by desc")
+		return
+	default:
+		queryItems = append(queryItems, QueryItem{Key: "by", Values: []string{conf.SearchBy}})
+	}
+	queryItems = append(queryItems, QueryItem{Key: "arg", Values: conf.Args})
+	bytes, err = repo.rpc(conf, queryItems)
+	return
+}
+
+// searchBy searches arg in the RPC field by (e.g. "provides").
+func (repo UserRepo) searchBy(conf Conf, by string, arg string) (pkgs []Package, err error) {
 	queryItems := []QueryItem{
 		{Key: "type", Values: []string{"search"}},
-		{Key: "arg", Values: conf.Args},
+		{Key: "by", Values: []string{by}},
+		{Key: "arg", Values: []string{arg}},
+	}
+	bytes, err := repo.rpc(conf, queryItems)
+	if err != nil {
+		return
 	}
-	url := UserRPCURL + "?" + BuildQueryString(queryItems)
-	res, err := http.Get(url)
+	res, err := repo.ParseSearchResponse(bytes)
 	if err != nil {
 		return
 	}
-	defer res.Body.Close()
-	bytes, err = ioutil.ReadAll(res.Body)
+	for _, result := range res.Results {
+		pkgs = append(pkgs, result.Package())
+	}
 	return
 }
 
 func (repo UserRepo) ParseSearchResponse(bytes []byte) (response UserSearchResponse, err error) {
 	err = json.Unmarshal(bytes, &response)
+	if err == nil && response.Type == "error" {
+		err = errors.New(response.Error)
+	}
 	return
 }
 
-func (repo UserRepo) PrintSearchResponse(conf Conf) (err error) {
-	bytes, err := repo.Search(conf)
+func (repo UserRepo) Search(conf Conf) (pkgs []Package, err error) {
+	bytes, err := repo.SearchRaw(conf)
 	if err != nil {
 		return
 	}
-	if conf.JsonFlag {
-		fmt.Println(string(bytes[:]))
-	} else {
-		res, err := repo.ParseSearchResponse(bytes)
-		if err != nil {
-			return err
-		}
-		for _, pkg := range res.Results {
-			color.New(color.FgBlue).Add(color.Bold).Print("aur")
-			color.New(color.Bold).Printf("/%s ", pkg.Name)
-			if pkg.OutOfDate != 0 {
-				color.New(color.FgRed).Add(color.Bold).Print(pkg.Version)
-			} else {
-				color.New(color.Bold).Print(pkg.Version)
-			}
-			fmt.Printf(" (%d)\n", pkg.NumVotes)
-			fmt.Printf("    %s\n", pkg.Description)
-		}
+	res, err := repo.ParseSearchResponse(bytes)
+	if err != nil {
+		return
+	}
+	pkgs = make([]Package, 0, len(res.Results))
+	for _, result := range res.Results {
+		pkgs = append(pkgs, result.Package())
 	}
 	return
 }
 
-func (repo UserRepo) Info(conf Conf) (bytes []byte, err error) {
-	queryItems := []QueryItem{
-		{Key: "type", Values: []string{"info"}},
-		{Key: "arg", Values: conf.Args},
+func (result UserSearchResult) Package() (pkg Package) {
+	pkg = Package{
+		Repo:           UserRepoName,
+		Name:           result.Name,
+		Base:           result.PackageBase,
+		Version:        result.Version,
+		Epoch:          ParseEpoch(result.Version),
+		Description:    result.Description,
+		URL:            result.URL,
+		Licenses:       result.License,
+		Groups:         result.Groups,
+		Depends:        result.Depends,
+		MakeDepends:    result.MakeDepends,
+		CheckDepends:   result.CheckDepends,
+		OptDepends:     result.OptDepends,
+		Provides:       result.Provides,
+		Conflicts:      result.Conflicts,
+		Replaces:       result.Replaces,
+		Keywords:       result.Keywords,
+		FirstSubmitted: unixTime(result.FirstSubmitted),
+		LastModified:   unixTime(result.LastModified),
+		FlagDate:       unixTime(result.OutOfDate),
+		OutOfDate:      result.OutOfDate != 0,
+		Votes:          result.NumVotes,
+		Popularity:     result.Popularity,
+		SnapshotURL:    result.URLPath,
 	}
-	url := UserRPCURL + "?" + BuildQueryString(queryItems)
-	res, err := http.Get(url)
-	if err != nil {
-		return
+	if result.Maintainer != "" {
+		pkg.Maintainers = []string{result.Maintainer}
 	}
-	defer res.Body.Close()
-	bytes, err = ioutil.ReadAll(res.Body)
+	if pkg.Base == "" {
+		pkg.Base = pkg.Name
+	}
+	return
+}
+
+func (repo UserRepo) InfoRaw(conf Conf) (bytes []byte, err error) {
+	bytes, err = repo.rpc(conf, infoQueryItems(conf.Args))
 	return
 }
 
@@ -113,76 +176,104 @@ type UserInfoResponse struct {
 	Version     int
 	Type        string
 	ResultCount int
-	Results     UserInfoResult
+	Results     []UserInfoResult
+	Error       string
 }
 type UserInfoResult UserSearchResult
 
 func (repo UserRepo) ParseInfoResponse(bytes []byte) (response UserInfoResponse, err error) {
 	err = json.Unmarshal(bytes, &response)
-	return
-}
-
-func (repo UserRepo) PrintInfoResponse(conf Conf) (err error) {
-	bytes, err := repo.Info(conf)
 	if err != nil {
 		return
 	}
-	if conf.JsonFlag {
-		fmt.Println(string(bytes[:]))
-	} else {
-		res, err := repo.ParseInfoResponse(bytes)
-		if err != nil {
-			return err
-		}
-		pkg := res.Results
-		str := `Repository      : %s
-Name            : %s
-Version         : %s
-Description     : %s
-URL             : %s
-License         : %s
-Maintainer      : %s
-Submitted       : %s
-Last Modified   : %s
-Snapshot        : %s
-Votes           : %d
-`
-		re := regexp.MustCompile("\\s*([^:]+:)([^\\n]*)\\n")
-		str = re.ReplaceAllString(str, "\x1b[1m$1\x1b[0m$2\n")
-		submitDate := time.Unix(int64(pkg.FirstSubmitted), 0)
-		modifiedDate := time.Unix(int64(pkg.LastModified), 0)
-		fmt.Printf(str, "aur", pkg.Name, pkg.Version, pkg.Description, pkg.URL, pkg.License,
-			pkg.Maintainer, submitDate, modifiedDate,
-			pkg.URLPath, pkg.NumVotes)
+	if response.Type == "error" {
+		err = errors.New(response.Error)
+	} else if len(response.Results) == 0 {
+		err = ErrNotFound
 	}
 	return
 }
 
-func (repo UserRepo) GetInfoToDownload(conf Conf) (res UserInfoResponse, url string, err error) {
-	bytes, err := repo.Info(conf)
+func (repo UserRepo) Info(conf Conf) (pkg Package, err error) {
+	bytes, err := repo.InfoRaw(conf)
 	if err != nil {
 		return
 	}
-	res, err = repo.ParseInfoResponse(bytes)
+	res, err := repo.ParseInfoResponse(bytes)
 	if err != nil {
 		return
 	}
-	url = UserBaseURL + res.Results.URLPath
+	pkg = UserSearchResult(res.Results[0]).Package()
 	return
 }
 
-func (repo UserRepo) DownloadTarGz(conf Conf, url string, outDir string) (newOutFilePath string, err error) {
-	outFile, newOutFilePath, err := createOutFile(outDir, url)
-	defer outFile.Close()
+// UserRPCMaxURLLength is the URL length above which MultiInfo splits its requests.
+const UserRPCMaxURLLength = 4000
+
+// infoQueryItems builds the query of a (multi)info request for names.
+func infoQueryItems(names []string) (queryItems []QueryItem) {
+	queryItems = []QueryItem{{Key: "type", Values: []string{"info"}}}
+	for _, name := range names {
+		queryItems = append(queryItems, QueryItem{Key: "arg[]", Values: []string{name}})
+	}
+	return
+}
+
+// chunkNames splits names so that the info URL for each chunk fits in UserRPCMaxURLLength.
+func (repo UserRepo) chunkNames(conf Conf, names []string) (chunks [][]string) {
+	baseLength := len(repo.BaseURL(conf) + UserRPCPath + "?" + BuildQueryString(infoQueryItems(nil)) + "&v=" + UserRPCVersion)
+	length := baseLength
+	var chunk []string
+	for _, name := range names {
+		itemLength := len("&" + BuildQueryString(infoQueryItems([]string{name})[1:]))
+		if len(chunk) != 0 && length+itemLength > UserRPCMaxURLLength {
+			chunks = append(chunks, chunk)
+			chunk, length = nil, baseLength
+		}
+		chunk = append(chunk, name)
+		length += itemLength
+	}
+	if len(chunk) != 0 {
+		chunks = append(chunks, chunk)
+	}
+	return
+}
+
+// MultiInfo returns the packages called names, batching them into as few requests as possible.
+// Unknown names are skipped.
+func (repo UserRepo) MultiInfo(conf Conf, names []string) (pkgs []Package, err error) {
+	for _, chunk := range repo.chunkNames(conf, names) {
+		var bytes []byte
+		bytes, err = repo.rpc(conf, infoQueryItems(chunk))
+		if err != nil {
+			return
+		}
+		var res UserInfoResponse
+		err = json.Unmarshal(bytes, &res)
+		if err != nil {
+			return
+		}
+		if res.Type == "error" {
+			err = errors.New(res.Error)
+			return
+		}
+		for _, result := range res.Results {
+			pkgs = append(pkgs, UserSearchResult(result).Package())
+		}
+	}
+	return
+}
+
+func (repo UserRepo) GetInfoToDownload(conf Conf) (res UserInfoResponse, url string, err error) {
+	bytes, err := repo.InfoRaw(conf)
 	if err != nil {
 		return
 	}
-	resp, err := http.Get(url)
+	res, err = repo.ParseInfoResponse(bytes)
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-	_, err = io.Copy(outFile, resp.Body)
+	url = repo.BaseURL(conf) + res.Results[0].URLPath
 	return
 }
 
@@ -191,9 +282,13 @@ func (repo UserRepo) Get(conf Conf) (newOutFilePath string, err error) {
 	if err != nil {
 		return
 	}
-	result := info.Results
+	result := info.Results[0]
+	pkgBase := result.PackageBase
+	if pkgBase == "" {
+		pkgBase = result.Name
+	}
 
-	destDir := path.Join(conf.OutDir, result.Name)
+	destDir := path.Join(conf.OutDir, pkgBase)
 	_, err = os.Stat(destDir)
 	if err == nil {
 		err = errors.New(destDir + " already exists")
@@ -201,27 +296,16 @@ func (repo UserRepo) Get(conf Conf) (newOutFilePath string, err error) {
 	}
 	err = nil
 
-	tempDir, err := ioutil.TempDir("", "srchway-")
-	if err != nil {
-		return
-	}
-
-	color.New(color.FgBlue).Add(color.Bold).Println("Downloading " + url + " ...")
-	tarGzPath, err := repo.DownloadTarGz(conf, url, tempDir)
-	if err != nil {
-		return
-	}
-
-	color.New(color.FgBlue).Add(color.Bold).Println("Extracting " + tarGzPath + " ...")
-	newOutFilePath, err = ExtractAndRemoveTarGz(tarGzPath)
+	// snapshots contain a single "<pkgbase>" directory
+	color.New(color.FgBlue).Add(color.Bold).Println("Downloading " + url + " to " + destDir + " ...")
+	err = DownloadAndExtract(conf, url, destDir, 1)
+	newOutFilePath = destDir
+	return
+}
 
-	srcDir := path.Join(newOutFilePath, result.Name)
-	color.New(color.FgBlue).Add(color.Bold).Println("Copying " + srcDir + " to " + destDir + " ...")
-	err = shutil.CopyTree(srcDir, destDir, nil)
-	if err != nil {
-		return
+func unixTime(sec int) (t time.Time) {
+	if sec != 0 {
+		t = time.Unix(int64(sec), 0)
 	}
-
-	err = os.RemoveAll(tempDir)
 	return
 }
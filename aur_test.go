@@ -0,0 +1,119 @@
+package srchway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUserGet(t *testing.T) {
+	snapshotPath := "/cgit/aur.git/snapshot/python-foo.tar.gz"
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requested = append(requested, req.URL.Path)
+		switch {
+		case req.URL.Path == UserRPCPath && req.URL.Query().Get("arg[]") == "python-foo-docs":
+			w.Write([]byte(`{"version":5,"type":"multiinfo","resultcount":1,"results":[{"Name":"python-foo-docs",` +
+				`"PackageBase":"python-foo","Version":"1.0-1","URLPath":"` + snapshotPath + `"}]}`))
+		case req.URL.Path == UserRPCPath:
+			w.Write([]byte(`{"version":5,"type":"multiinfo","resultcount":0,"results":[]}`))
+		case req.URL.Path == snapshotPath:
+			w.Write(buildTarGz(t, tarDir("python-foo/"), tarFile("python-foo/PKGBUILD", "pkgbase=python-foo"),
+				tarFile("python-foo/.SRCINFO", "pkgbase = python-foo")))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+	outDir := t.TempDir()
+	conf := Conf{UserURL: srv.URL, OutDir: outDir, Args: []string{"python-foo-docs"}}
+	destDir, err := UserRepo{}.Get(conf)
+	if err != nil {
+		t.Fatalf("Get() = %v (requested %q)", err, requested)
+	}
+	if want := filepath.Join(outDir, "python-foo"); destDir != want {
+		t.Errorf("Get() = %s, want %s", destDir, want)
+	}
+	if last := requested[len(requested)-1]; last != snapshotPath {
+		t.Errorf("downloaded %s, want %s", last, snapshotPath)
+	}
+	// the "<pkgbase>" directory is stripped
+	checkFile(t, filepath.Join(destDir, "PKGBUILD"), "pkgbase=python-foo")
+	checkFile(t, filepath.Join(destDir, ".SRCINFO"), "pkgbase = python-foo")
+
+	conf.Args = []string{"nonexistent"}
+	if _, err := (UserRepo{}).Get(conf); err == nil {
+		t.Error("Get(nonexistent) = nil error")
+	}
+}
+
+func TestUserMultiInfoChunks(t *testing.T) {
+	var srvURL string
+	var urlLengths []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		urlLengths = append(urlLengths, len(srvURL+req.URL.RequestURI()))
+		res := UserInfoResponse{Version: 5, Type: "multiinfo"}
+		for _, name := range req.URL.Query()["arg[]"] {
+			switch {
+			case name == "rpc-error":
+				res = UserInfoResponse{Version: 5, Type: "error", Error: "Too many package results."}
+			case !strings.HasPrefix(name, "unknown-"):
+				res.Results = append(res.Results, UserInfoResult{Name: name, Version: "1-1"})
+			}
+		}
+		if res.Type == "error" {
+			res.Results = nil
+		}
+		res.ResultCount = len(res.Results)
+		bytes, _ := json.Marshal(res)
+		w.Write(bytes)
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+	conf := Conf{UserURL: srv.URL}
+
+	var names, want []string
+	for i := 0; i < 400; i++ {
+		name := fmt.Sprintf("python-package-number-%03d", i)
+		if i%10 == 0 {
+			name = "unknown-" + name
+		} else {
+			want = append(want, name)
+		}
+		names = append(names, name)
+	}
+	pkgs, err := UserRepo{}.MultiInfo(conf, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urlLengths) < 2 {
+		t.Errorf("MultiInfo() made %d requests, want several", len(urlLengths))
+	}
+	for i, length := range urlLengths {
+		if length > UserRPCMaxURLLength {
+			t.Errorf("request URL of %d bytes, longer than %d", length, UserRPCMaxURLLength)
+		}
+		// each chunk but the last is full (one more name would not fit)
+		if i < len(urlLengths)-1 && length+len("&arg%5B%5D=unknown-python-package-number-000") <= UserRPCMaxURLLength {
+			t.Errorf("request URL of %d bytes, more names would fit", length)
+		}
+	}
+	var got []string
+	for _, pkg := range pkgs {
+		got = append(got, pkg.Name)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MultiInfo() = %d packages, want %d (merged from every chunk)", len(got), len(want))
+	}
+
+	// an RPC error in a later chunk is returned
+	names[len(names)-1] = "rpc-error"
+	if _, err := (UserRepo{}).MultiInfo(conf, names); err == nil || err.Error() != "Too many package results." {
+		t.Errorf("MultiInfo() with an RPC error = %v", err)
+	}
+}
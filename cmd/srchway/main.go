@@ -1,33 +1,110 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/fatih/color"
 	"github.com/taskie/srchway"
 )
 
 func search(conf srchway.Conf) (exitCode int) {
-	exitCode = 1
-	repos := conf.Repos()
-	for _, repo := range repos {
-		err := repo.PrintSearchResponse(conf)
+	pkgs, errs := srchway.SearchAll(conf)
+	failures := 0
+	for _, err := range errs {
+		var truncated *srchway.TruncatedError
+		if errors.As(err, &truncated) {
+			color.New(color.FgYellow).Fprintln(os.Stderr, "warning: "+err.Error())
+			continue
+		}
+		fmt.Fprintln(os.Stderr, err)
+		failures++
+	}
+	if failures == len(conf.Repos()) {
+		return 1
+	}
+	err := srchway.PrintPackages(conf, pkgs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = 1
+	}
+	return
+}
+
+// multiInfo looks up several packages, batching the AUR queries into multiinfo requests.
+func multiInfo(conf srchway.Conf) (exitCode int) {
+	found := make(map[string]srchway.Package)
+	for _, repo := range conf.Repos() {
+		rest := make([]string, 0)
+		for _, name := range conf.Args {
+			if _, ok := found[name]; !ok {
+				rest = append(rest, name)
+			}
+		}
+		if len(rest) == 0 {
+			break
+		}
+		if user, ok := repo.(srchway.UserRepo); ok {
+			pkgs, err := user.MultiInfo(conf, rest)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			for _, pkg := range pkgs {
+				found[pkg.Name] = pkg
+			}
+			continue
+		}
+		for _, name := range rest {
+			c := conf
+			c.Args = []string{name}
+			pkg, err := repo.Info(c)
+			if err == nil {
+				found[name] = pkg
+			} else if !srchway.IsNotFound(err) {
+				fmt.Fprintln(os.Stderr, name+": "+err.Error())
+			}
+		}
+	}
+	pkgs := make([]srchway.Package, 0, len(found))
+	for _, name := range conf.Args {
+		if pkg, ok := found[name]; ok {
+			pkgs = append(pkgs, pkg)
+		} else {
+			fmt.Fprintln(os.Stderr, name+": not found")
+			exitCode = 1
+		}
+	}
+	if len(pkgs) != 0 {
+		srchway.SetRequiredBy(conf, pkgs)
+		err := srchway.PrintPackageInfo(conf, pkgs...)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-		} else {
-			exitCode = 0
+			exitCode = 1
 		}
 	}
 	return
 }
 
 func info(conf srchway.Conf) (exitCode int) {
+	if len(conf.Args) > 1 {
+		return multiInfo(conf)
+	}
 	exitCode = 1
 	repos := conf.Repos()
 	for _, repo := range repos {
-		err := repo.PrintInfoResponse(conf)
+		pkg, err := repo.Info(conf)
+		if err == nil {
+			pkgs := []srchway.Package{pkg}
+			srchway.SetRequiredBy(conf, pkgs)
+			err = srchway.PrintPackageInfo(conf, pkgs...)
+		}
 		if err == nil {
 			exitCode = 0
 			break
@@ -38,7 +115,51 @@ func info(conf srchway.Conf) (exitCode int) {
 	return
 }
 
+func getWithDeps(conf srchway.Conf) (exitCode int) {
+	plan, err := srchway.NewResolver(conf).Resolve(conf.Args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(plan.Repo) != 0 {
+		color.New(color.Bold).Println("Repository dependencies:")
+		for _, pkg := range plan.Repo {
+			fmt.Printf("    %s %s\n", pkg.FullName(), pkg.Version)
+		}
+	}
+	if len(plan.Missing) != 0 {
+		color.New(color.FgRed).Add(color.Bold).Println("Missing dependencies:")
+		for _, dep := range plan.Missing {
+			fmt.Printf("    %s\n", dep)
+		}
+		exitCode = 1
+	}
+	if len(plan.Unverified) != 0 {
+		color.New(color.FgYellow).Add(color.Bold).Println("Unverified dependencies (official packages may provide them; no sync database to check):")
+		for _, dep := range plan.Unverified {
+			fmt.Printf("    %s\n", dep)
+		}
+	}
+	color.New(color.Bold).Println("Build order:")
+	for i, pkg := range plan.Order {
+		fmt.Printf("%4d. %s %s\n", i+1, pkg.Base, pkg.Version)
+	}
+	for _, pkg := range plan.Order {
+		c := conf
+		c.Args = []string{pkg.Name}
+		_, err := srchway.UserRepo{}.Get(c)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+		}
+	}
+	return
+}
+
 func get(conf srchway.Conf) (exitCode int) {
+	if conf.DepsFlag {
+		return getWithDeps(conf)
+	}
 	exitCode = 1
 	repos := conf.Repos()
 	for _, repo := range repos {
@@ -54,11 +175,197 @@ func get(conf srchway.Conf) (exitCode int) {
 	return
 }
 
+func fetch(conf srchway.Conf) (exitCode int) {
+	dir := "."
+	if len(conf.Args) != 0 {
+		dir = conf.Args[0]
+	}
+	err := srchway.Fetch(conf, dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = 1
+	}
+	return
+}
+
+func checkUpdates(conf srchway.Conf) (exitCode int) {
+	updates, err := srchway.CheckUpdates(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if conf.JsonFlag || conf.Format == "json" {
+		if updates == nil {
+			updates = []srchway.Update{}
+		}
+		bytes, err := json.MarshalIndent(updates, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(bytes))
+		return
+	}
+	for _, update := range updates {
+		color.New(color.Bold).Print(update.Local.Name)
+		fmt.Print(" " + update.Local.Version)
+		if update.Newer {
+			fmt.Print(" -> ")
+			color.New(color.FgGreen).Add(color.Bold).Print(update.Remote.Version)
+		}
+		if update.OutOfDate {
+			color.New(color.FgRed).Print(" [out-of-date]")
+		}
+		if update.Orphaned {
+			color.New(color.FgYellow).Print(" [orphaned]")
+		}
+		if update.Deleted {
+			color.New(color.FgRed).Add(color.Bold).Print(" [not in AUR]")
+		}
+		fmt.Println()
+	}
+	return
+}
+
+func files(conf srchway.Conf) (exitCode int) {
+	matches, err := srchway.SearchFiles(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if conf.JsonFlag || conf.Format == "json" {
+		if matches == nil {
+			matches = []srchway.FileMatch{}
+		}
+		bytes, err := json.MarshalIndent(matches, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(bytes))
+		return
+	}
+	for _, match := range matches {
+		color.New(color.FgBlue).Add(color.Bold).Print(match.Repo)
+		color.New(color.Bold).Print("/" + match.Name)
+		fmt.Println(" " + match.Path)
+	}
+	if len(matches) == 0 {
+		exitCode = 1
+	}
+	return
+}
+
+func list(conf srchway.Conf) (exitCode int) {
+	fileList, err := srchway.ListFiles(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if conf.JsonFlag || conf.Format == "json" {
+		bytes, err := json.MarshalIndent(fileList, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(bytes))
+		return
+	}
+	color.New(color.FgBlue).Add(color.Bold).Print(fileList.Repo)
+	color.New(color.Bold).Printf("/%s %s\n", fileList.Name, fileList.Version)
+	err = fileList.WriteTree(os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = 1
+	}
+	return
+}
+
+func printReverseDeps(label string, pkgs []srchway.Package) {
+	color.New(color.Bold).Printf("%s (%d)\n", label, len(pkgs))
+	for _, pkg := range pkgs {
+		fmt.Printf("    %s %s\n", pkg.FullName(), pkg.Version)
+	}
+}
+
+func reverseDeps(conf srchway.Conf) (exitCode int) {
+	if len(conf.Args) == 0 {
+		fmt.Fprintln(os.Stderr, "please specify package name")
+		return 1
+	}
+	all := make([]srchway.ReverseDeps, 0, len(conf.Args))
+	for _, name := range conf.Args {
+		rdeps, errs := srchway.ReverseDependencies(conf, name)
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+		}
+		all = append(all, rdeps)
+	}
+	if conf.JsonFlag || conf.Format == "json" {
+		bytes, err := json.MarshalIndent(all, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(bytes))
+		return
+	}
+	for i, rdeps := range all {
+		if i != 0 {
+			fmt.Println()
+		}
+		color.New(color.FgBlue).Add(color.Bold).Println(rdeps.Name)
+		printReverseDeps("Required By", rdeps.Depends)
+		printReverseDeps("Make Dependency Of", rdeps.MakeDepends)
+		printReverseDeps("Check Dependency Of", rdeps.CheckDepends)
+		printReverseDeps("Optional For", rdeps.OptDepends)
+	}
+	return
+}
+
+func graph(conf srchway.Conf) (exitCode int) {
+	if len(conf.Args) == 0 {
+		fmt.Fprintln(os.Stderr, "please specify package name")
+		return 1
+	}
+	g, err := srchway.BuildGraph(conf, conf.Args, conf.Depth)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if conf.JsonFlag || conf.Format == "json" {
+		bytes, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(bytes))
+		return
+	}
+	err = g.WriteDOT(os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitCode = 1
+	}
+	return
+}
+
 const usage = `usage: srchway [OPERATION] [OPTIONS] [QUERY]
+       srchway fetch [OPTIONS] [DIRECTORY]
+       srchway check-updates [OPTIONS]
 OPERATION:
     -s, --search    search package
     -i, --info      show package info
     -g, --get       get PKGBUILD
+    --fetch         download and verify the sources listed in .SRCINFO
+    --graph         print the dependency graph in Graphviz DOT (or JSON with --json)
+    --rdeps         list the packages depending on a package (official ones from the sync databases)
+    -l, --list      list the files of an official package as a tree
+    -F, --files     find the packages owning a file (path, file name or, with -x, regex)
+    -u, --check-updates
+                    list installed foreign packages which are newer, out-of-date,
+                    orphaned or deleted in the AUR
     -h, --help      show help
     -V, --version   show version
 
@@ -67,8 +374,37 @@ OPTIONS:
     -A, --auronly   use AUR only (no offcial repo)
     -m, --multilib  use multilib repo
     -t, --testing   use testing repo
-    -j, --json      output raw JSON (when --search, --info)
-    -v, --verbose   verbose mode`
+    --repo REPOS    comma-separated official repositories to use instead of the default ones
+                    (e.g. core,extra,multilib-testing); with the sync databases, any
+                    database name (e.g. a third-party repository)
+    --syncdb        use the pacman sync databases (<dbpath>/sync/*.db, or *.files when --list)
+                    instead of the official web API
+    --arch ARCH     architecture of the official packages and of source_<arch> (default: x86_64)
+    -j, --json      output JSON (same as --format json)
+    --format FORMAT output format (when --search, --info): pacman, compact, table,
+                    json, yaml, csv or a Go template such as '{{.Name}} {{.Version}}'
+    --by FIELD      search field (when --search): name, name-desc (default), desc (official only),
+                    maintainer, depends, makedepends, optdepends, checkdepends, provides,
+                    conflicts, replaces, keywords, groups, submitter or comaintainers (AUR only)
+    --limit N       maximum number of official packages to search (default: 1000)
+    -x, --regex     interpret the query as a regular expression (when --files)
+    --remote        use the official web API instead of the files databases (when --files)
+    -v, --verbose   verbose mode
+    --git           clone the packaging repository instead of downloading a snapshot (when --get)
+    --normalize     extract files with modes 0644/0755 and a fixed modification time
+                    instead of those of the snapshot (when --get)
+    --deps          also get AUR dependencies and print the build order (when --get)
+    --depth N       maximum depth of the dependencies followed (when --graph, default: no limit)
+    --official-url URL
+                    base URL of the official repository web API
+    --aur-url URL   base URL of the AUR
+    --packaging-url URL
+                    base URL of the official packaging repositories
+    --dbpath PATH   pacman database directory (default: /var/lib/pacman)
+    --timeout DURATION
+                    HTTP timeout (e.g. 10s); the repositories searched together
+                    share one deadline (default: 30s)
+    --proxy URL     HTTP proxy`
 
 func help(conf srchway.Conf) (exitCode int) {
 	fmt.Println(usage)
@@ -82,10 +418,29 @@ func version(conf srchway.Conf) (exitCode int) {
 	return
 }
 
-func parseOption(arg string, conf *srchway.Conf) (err error) {
+// optionsWithValue lists the long options which take an argument ("--opt value" or "--opt=value").
+var optionsWithValue = map[string]bool{
+	"--official-url":  true,
+	"--aur-url":       true,
+	"--packaging-url": true,
+	"--timeout":       true,
+	"--proxy":         true,
+	"--format":        true,
+	"--dbpath":        true,
+	"--by":            true,
+	"--limit":         true,
+	"--arch":          true,
+	"--repo":          true,
+	"--depth":         true,
+}
+
+func parseOption(arg string, value string, conf *srchway.Conf) (err error) {
 	if !strings.HasPrefix(arg, "--") && strings.HasPrefix(arg, "-") {
 		for i := 1; i < len(arg); i++ {
-			parseOption(arg[i:i+1], conf)
+			err = parseOption(arg[i:i+1], "", conf)
+			if err != nil {
+				return
+			}
 		}
 		return
 	}
@@ -103,6 +458,24 @@ func parseOption(arg string, conf *srchway.Conf) (err error) {
 		conf.Operation = srchway.OperationTypeHelp
 	case "V", "--version":
 		conf.Operation = srchway.OperationTypeVersion
+	case "--fetch":
+		conf.Operation = srchway.OperationTypeFetch
+	case "--graph":
+		conf.Operation = srchway.OperationTypeGraph
+	case "--depth":
+		conf.Depth, err = strconv.Atoi(value)
+	case "--rdeps":
+		conf.Operation = srchway.OperationTypeReverseDeps
+	case "l", "--list":
+		conf.Operation = srchway.OperationTypeList
+	case "F", "--files":
+		conf.Operation = srchway.OperationTypeFiles
+	case "x", "--regex":
+		conf.RegexFlag = true
+	case "--remote":
+		conf.RemoteFlag = true
+	case "u", "--check-updates":
+		conf.Operation = srchway.OperationTypeCheckUpdates
 	case "a", "--aur":
 		conf.AurFlag = true
 	case "A", "--auronly":
@@ -112,10 +485,53 @@ func parseOption(arg string, conf *srchway.Conf) (err error) {
 		conf.MultilibFlag = true
 	case "t", "--testing":
 		conf.TestingFlag = true
+	case "--arch":
+		conf.Arch = value
+	case "--syncdb":
+		conf.SyncDBFlag = true
+	case "--repo":
+		conf.RepoNames, err = srchway.ParseRepoList(value)
 	case "j", "--json":
 		conf.JsonFlag = true
+	case "--format":
+		conf.Format = value
+		_, err = srchway.NewFormatter(value)
+	case "--by":
+		if !srchway.IsSearchField(value) {
+			err = errors.New("unknown search field: " + value)
+			return
+		}
+		conf.SearchBy = value
+	case "--limit":
+		conf.Limit, err = strconv.Atoi(value)
+		if err == nil && conf.Limit <= 0 {
+			err = errors.New("--limit must be positive")
+		}
 	case "v", "--verbose":
 		conf.Verbose = true
+	case "--git":
+		conf.GitFlag = true
+	case "--normalize":
+		conf.NormalizeFlag = true
+	case "--deps":
+		conf.DepsFlag = true
+	case "--official-url":
+		conf.OfficialURL = value
+	case "--aur-url":
+		conf.UserURL = value
+	case "--packaging-url":
+		conf.PackagingURL = value
+	case "--dbpath":
+		conf.DBPath = value
+	case "--timeout":
+		conf.Timeout, err = time.ParseDuration(value)
+	case "--proxy":
+		var proxyURL *url.URL
+		proxyURL, err = url.Parse(value)
+		if err != nil {
+			return
+		}
+		conf.HTTPClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
 	default:
 		err = errors.New("unknown option: " + arg)
 		return
@@ -123,28 +539,60 @@ func parseOption(arg string, conf *srchway.Conf) (err error) {
 	return
 }
 
+// subcommands maps operation words (e.g. "srchway fetch") to operations.
+var subcommands = map[string]srchway.OperationType{
+	"fetch":         srchway.OperationTypeFetch,
+	"check-updates": srchway.OperationTypeCheckUpdates,
+}
+
 func parseArgs(args []string) (conf srchway.Conf, err error) {
 	conf.OfficialFlag = true
-	breakCount := 0
-	for i, arg := range args[1:] {
+	i := 1
+	if len(args) > 1 {
+		if operation, ok := subcommands[args[1]]; ok {
+			conf.Operation = operation
+			i++
+		}
+	}
+	for ; i < len(args); i++ {
+		arg := args[i]
 		if arg == "--" {
-			breakCount = i + 1
+			i++
 			break
-		} else if arg[0] == '-' {
-			err = parseOption(arg, &conf)
-			if err != nil {
+		} else if arg == "" || arg[0] != '-' {
+			break
+		}
+		value := ""
+		if strings.HasPrefix(arg, "--") && strings.Contains(arg, "=") {
+			parts := strings.SplitN(arg, "=", 2)
+			arg, value = parts[0], parts[1]
+		} else if optionsWithValue[arg] {
+			if i+1 >= len(args) {
+				err = errors.New("option requires an argument: " + arg)
 				return
 			}
-		} else {
-			breakCount = i
-			break
+			i++
+			value = args[i]
+		}
+		err = parseOption(arg, value, &conf)
+		if err != nil {
+			return
 		}
 	}
 	if conf.Operation == srchway.OperationTypeNone {
 		err = errors.New("you must specify just one operation type")
 		return
 	}
-	conf.Args = args[breakCount+1:]
+	err = conf.CheckRepoNames()
+	if err != nil {
+		return
+	}
+	if conf.Timeout > 0 {
+		client := *conf.Client()
+		client.Timeout = conf.Timeout
+		conf.HTTPClient = &client
+	}
+	conf.Args = args[i:]
 	return
 }
 
@@ -164,6 +612,18 @@ func main() {
 		exitCode = info(conf)
 	case srchway.OperationTypeGet:
 		exitCode = get(conf)
+	case srchway.OperationTypeFetch:
+		exitCode = fetch(conf)
+	case srchway.OperationTypeGraph:
+		exitCode = graph(conf)
+	case srchway.OperationTypeReverseDeps:
+		exitCode = reverseDeps(conf)
+	case srchway.OperationTypeList:
+		exitCode = list(conf)
+	case srchway.OperationTypeFiles:
+		exitCode = files(conf)
+	case srchway.OperationTypeCheckUpdates:
+		exitCode = checkUpdates(conf)
 	case srchway.OperationTypeHelp:
 		exitCode = help(conf)
 	case srchway.OperationTypeVersion:
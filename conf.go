@@ -1,5 +1,14 @@
 package srchway
 
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// DefaultArch is the architecture used when Conf.Arch is not set.
+const DefaultArch = "x86_64"
+
 type OperationType int
 
 const (
@@ -9,23 +18,73 @@ const (
 	OperationTypeGet
 	OperationTypeHelp
 	OperationTypeVersion
+	OperationTypeFetch
+	OperationTypeCheckUpdates
+	OperationTypeFiles
+	OperationTypeList
+	OperationTypeReverseDeps
+	OperationTypeGraph
 )
 
 type Conf struct {
-	Operation    OperationType
-	Args         []string
-	OutDir       string
-	Verbose      bool
-	AurFlag      bool
-	OfficialFlag bool
-	JsonFlag     bool
-	MultilibFlag bool
-	TestingFlag  bool
+	Operation     OperationType
+	Args          []string
+	OutDir        string
+	Verbose       bool
+	AurFlag       bool
+	OfficialFlag  bool
+	JsonFlag      bool
+	Format        string
+	SearchBy      string
+	Limit         int
+	Arch          string
+	MultilibFlag  bool
+	RepoNames     []string
+	TestingFlag   bool
+	GitFlag       bool
+	NormalizeFlag bool
+	DepsFlag      bool
+	Depth         int
+	SyncDBFlag    bool
+	RegexFlag     bool
+	RemoteFlag    bool
+	OfficialURL   string
+	UserURL       string
+	PackagingURL  string
+	DBPath        string
+	Timeout       time.Duration
+	HTTPClient    *http.Client
+	// Context bounds the HTTP requests (e.g. with a shared deadline); nil means no bound.
+	Context context.Context
+}
+
+// Client returns conf.HTTPClient, or http.DefaultClient if it is not set.
+func (conf Conf) Client() *http.Client {
+	if conf.HTTPClient != nil {
+		return conf.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (conf Conf) arch() string {
+	if conf.Arch != "" {
+		return conf.Arch
+	}
+	return DefaultArch
+}
+
+func (conf Conf) context() context.Context {
+	if conf.Context != nil {
+		return conf.Context
+	}
+	return context.Background()
 }
 
 func (conf Conf) Repos() (repos []Repo) {
 	repos = make([]Repo, 0)
-	if conf.OfficialFlag {
+	if conf.OfficialFlag && conf.SyncDBFlag {
+		repos = append(repos, SyncDBRepo{})
+	} else if conf.OfficialFlag {
 		repos = append(repos, OfficialRepo{})
 	}
 	if conf.AurFlag {
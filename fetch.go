@@ -0,0 +1,339 @@
+package srchway
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/taskie/srchway/pkgbuild"
+	"github.com/taskie/srchway/srcinfo"
+	"golang.org/x/crypto/blake2b"
+)
+
+// ChecksumAlgorithms lists the checksum arrays supported by makepkg, strongest first.
+var ChecksumAlgorithms = []string{"b2", "sha512", "sha384", "sha256", "sha224", "sha1", "md5"}
+
+func newChecksumHash(algorithm string) (h hash.Hash, err error) {
+	switch algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha224":
+		h = sha256.New224()
+	case "sha256":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha512":
+		h = sha512.New()
+	case "b2":
+		h, err = blake2b.New512(nil)
+	default:
+		err = errors.New("unknown checksum algorithm: " + algorithm)
+	}
+	return
+}
+
+// Source is an entry of the source array of a PKGBUILD ("[name::][vcs+]url[#fragment]").
+type Source struct {
+	Name     string
+	URL      string
+	VCS      string
+	Fragment string
+	// Sums maps an algorithm name (e.g. "sha256") to the expected checksum or "SKIP".
+	Sums map[string]string
+}
+
+func ParseSource(entry string) (source Source) {
+	source.Sums = make(map[string]string)
+	url := entry
+	if i := strings.Index(url, "::"); i >= 0 {
+		source.Name = url[:i]
+		url = url[i+2:]
+	}
+	if i := strings.Index(url, "#"); i >= 0 {
+		source.Fragment = url[i+1:]
+		url = url[:i]
+	}
+	if i := strings.Index(url, "://"); i >= 0 {
+		scheme := url[:i]
+		if j := strings.Index(scheme, "+"); j >= 0 {
+			source.VCS = scheme[:j]
+			url = url[j+1:]
+		} else {
+			switch scheme {
+			case "git", "svn", "bzr", "hg", "fossil":
+				source.VCS = scheme
+			}
+		}
+	}
+	source.URL = url
+	if source.Name == "" {
+		source.Name = filepath.Base(strings.TrimSuffix(url, "/"))
+		if source.VCS != "" {
+			source.Name = strings.TrimSuffix(source.Name, "."+source.VCS)
+		}
+	}
+	return
+}
+
+// IsLocal reports whether the source is a file shipped alongside the PKGBUILD.
+func (source Source) IsLocal() bool {
+	return !strings.Contains(source.URL, "://")
+}
+
+// FragmentValue splits the fragment ("branch=foo") into its type and value.
+func (source Source) FragmentValue() (kind string, value string) {
+	parts := strings.SplitN(source.Fragment, "=", 2)
+	kind = parts[0]
+	if len(parts) == 2 {
+		value = parts[1]
+	}
+	return
+}
+
+// Verify checks the file at filePath against every checksum of the source.
+func (source Source) Verify(filePath string) (err error) {
+	for _, algorithm := range ChecksumAlgorithms {
+		sum, ok := source.Sums[algorithm]
+		if !ok || sum == "SKIP" {
+			continue
+		}
+		var actual string
+		actual, err = fileChecksum(algorithm, filePath)
+		if err != nil {
+			return
+		}
+		if !strings.EqualFold(actual, sum) {
+			err = fmt.Errorf("%s: %ssum mismatch (expected %s, actual %s)", source.Name, algorithm, sum, actual)
+			return
+		}
+	}
+	return
+}
+
+// HasSums reports whether the source has at least one checksum other than SKIP.
+func (source Source) HasSums() bool {
+	for _, sum := range source.Sums {
+		if sum != "SKIP" {
+			return true
+		}
+	}
+	return false
+}
+
+func fileChecksum(algorithm string, filePath string) (sum string, err error) {
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// ReadSources returns the sources of a .SRCINFO for the given architecture.
+func ReadSources(srcInfoPath string, arch string) (sources []Source, err error) {
+	info, err := srcinfo.ParseFile(srcInfoPath)
+	if err != nil {
+		return
+	}
+	sources = SrcInfoSources(info, arch)
+	return
+}
+
+// SrcInfoSources returns the source and source_<arch> entries of the pkgbase with their checksums.
+func SrcInfoSources(info *srcinfo.SrcInfo, arch string) (sources []Source) {
+	for _, a := range []string{"", arch} {
+		for i, entry := range info.Base.Values("source", a) {
+			source := ParseSource(entry)
+			for _, algorithm := range ChecksumAlgorithms {
+				sums := info.Base.Values(algorithm+"sums", a)
+				if i < len(sums) {
+					source.Sums[algorithm] = sums[i]
+				}
+			}
+			sources = append(sources, source)
+		}
+	}
+	return
+}
+
+// ReadSrcInfo reads the .SRCINFO in dir, or statically evaluates the PKGBUILD if there is none.
+// Parts of the PKGBUILD which cannot be evaluated are reported on stderr.
+func ReadSrcInfo(dir string) (info *srcinfo.SrcInfo, err error) {
+	srcInfoPath := filepath.Join(dir, ".SRCINFO")
+	if _, e := os.Stat(srcInfoPath); e == nil {
+		info, err = srcinfo.ParseFile(srcInfoPath)
+		return
+	}
+	pkgbuildPath := filepath.Join(dir, "PKGBUILD")
+	if _, e := os.Stat(pkgbuildPath); e != nil {
+		err = errors.New(dir + ": no .SRCINFO or PKGBUILD")
+		return
+	}
+	p, err := pkgbuild.ParseFile(pkgbuildPath)
+	if err != nil {
+		return
+	}
+	for _, u := range p.Unresolved {
+		fmt.Fprintln(os.Stderr, "warning: "+u.String())
+	}
+	info = p.SrcInfo()
+	return
+}
+
+// Fetch downloads every source listed in the .SRCINFO (or PKGBUILD) in dir and verifies its checksums.
+// The PKGBUILD is never executed.
+func Fetch(conf Conf, dir string) (err error) {
+	info, err := ReadSrcInfo(dir)
+	if err != nil {
+		return
+	}
+	sources := SrcInfoSources(info, conf.arch())
+	failures := 0
+	for _, source := range sources {
+		color.New(color.Bold).Printf("---- %s ----\n", source.Name)
+		e := FetchSource(conf, dir, source)
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			failures++
+		}
+	}
+	if failures != 0 {
+		err = errors.New(strconv.Itoa(failures) + " source(s) failed")
+	}
+	return
+}
+
+// CheckSourceName ensures that the file name of a source (which comes from an untrusted
+// .SRCINFO or PKGBUILD) stays in the package directory and cannot be taken as an option.
+func CheckSourceName(name string) (err error) {
+	switch {
+	case name == "":
+		err = errors.New("empty source name")
+	case name == ".", name == "..", filepath.IsAbs(name), strings.ContainsAny(name, "/\\"):
+		err = errors.New(name + ": source name must be a plain file name")
+	case strings.HasPrefix(name, "-"):
+		err = errors.New(name + ": source name must not start with -")
+	}
+	return
+}
+
+// FetchSource downloads (or clones) a single source into dir.
+func FetchSource(conf Conf, dir string, source Source) (err error) {
+	err = CheckSourceName(source.Name)
+	if err != nil {
+		return
+	}
+	filePath := filepath.Join(dir, source.Name)
+	switch {
+	case source.VCS == "git":
+		err = fetchGitSource(source, filePath)
+	case source.VCS != "":
+		err = errors.New(source.Name + ": " + source.VCS + " sources are not supported")
+	case source.IsLocal():
+		err = source.Verify(filePath)
+	case strings.HasPrefix(source.URL, "http://"), strings.HasPrefix(source.URL, "https://"):
+		err = fetchHTTPSource(conf, source, filePath)
+	default:
+		err = errors.New(source.Name + ": unsupported URL " + source.URL)
+	}
+	return
+}
+
+func fetchHTTPSource(conf Conf, source Source, filePath string) (err error) {
+	if _, e := os.Stat(filePath); e == nil {
+		if e = source.Verify(filePath); e == nil {
+			fmt.Println(source.Name + " already exists")
+			return
+		}
+	}
+	fmt.Println("Downloading " + source.URL + " ...")
+	resp, err := httpGetResponse(conf, source.URL)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	partPath := filePath + ".part"
+	file, err := os.Create(partPath)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(file, resp.Body)
+	file.Close()
+	if err == nil {
+		err = source.Verify(partPath)
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return
+	}
+	err = os.Rename(partPath, filePath)
+	return
+}
+
+func fetchGitSource(source Source, dirPath string) (err error) {
+	if _, e := os.Stat(dirPath); e == nil {
+		fmt.Println(source.Name + " already exists")
+		return
+	}
+	if source.HasSums() {
+		fmt.Fprintln(os.Stderr, source.Name+": checksums of VCS sources are not verified")
+	}
+	if strings.HasPrefix(source.URL, "-") {
+		err = errors.New(source.Name + ": URL must not start with -")
+		return
+	}
+	kind, value := source.FragmentValue()
+	if strings.HasPrefix(value, "-") {
+		err = errors.New(source.Name + ": fragment value must not start with -")
+		return
+	}
+	args := []string{"clone"}
+	switch kind {
+	case "":
+	case "branch", "tag":
+		args = append(args, "--depth", "1", "--branch", value)
+	case "commit":
+	default:
+		err = errors.New(source.Name + ": unsupported fragment #" + source.Fragment)
+		return
+	}
+	args = append(args, "--", source.URL, dirPath)
+	fmt.Println("Cloning " + source.URL + " ...")
+	err = runCommand("git", args...)
+	if err != nil || kind != "commit" {
+		return
+	}
+	err = runCommand("git", "-C", dirPath, "checkout", "--detach", value)
+	return
+}
+
+func runCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,40 @@
+package srchway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckSourceName(t *testing.T) {
+	valid := []string{"foo-1.0.tar.gz", "foo.patch", ".hidden", "foo..bar", "foo-1.0..patch", "..."}
+	for _, name := range valid {
+		if err := CheckSourceName(name); err != nil {
+			t.Errorf("CheckSourceName(%q) = %v, want nil", name, err)
+		}
+	}
+	invalid := []string{"", ".", "..", "../../evil", "/etc/passwd", "a/b", `a\b`, "-oops"}
+	for _, name := range invalid {
+		if err := CheckSourceName(name); err == nil {
+			t.Errorf("CheckSourceName(%q) = nil, want an error", name)
+		}
+	}
+}
+
+func TestFetchSourceRefusesUnsafeSources(t *testing.T) {
+	dir := t.TempDir()
+	entries := []string{
+		"../../evil::https://example.com/foo.tar.gz",
+		"x::git+--upload-pack=touch${IFS}/tmp/p;://a",
+		"x::git+https://example.com/x.git#branch=--upload-pack=touch",
+		"https://example.com/..",
+	}
+	for _, entry := range entries {
+		if err := FetchSource(Conf{}, dir, ParseSource(entry)); err == nil {
+			t.Errorf("FetchSource(%q) = nil, want an error", entry)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x")); err == nil {
+		t.Error("a git source was cloned")
+	}
+}
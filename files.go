@@ -0,0 +1,322 @@
+package srchway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/bytefmt"
+)
+
+// OfficialFilesResponse is the response of /packages/<repo>/<arch>/<pkg>/files/json/.
+type OfficialFilesResponse struct {
+	PkgName    string
+	Repo       string
+	Arch       string
+	FilesCount int `json:"files_count"`
+	DirCount   int `json:"dir_count"`
+	Files      []string
+}
+
+// FilesRaw fetches the file list of repoName/pkgName for arch.
+func (repo OfficialRepo) FilesRaw(conf Conf, repoName string, arch string, pkgName string) (bytes []byte, err error) {
+	url := repo.BaseURL(conf) + fmt.Sprintf("/%s/%s/%s/files/json/", repoName, arch, pkgName)
+	bytes, err = httpGet(conf, url)
+	return
+}
+
+func (repo OfficialRepo) ParseFilesResponse(bytes []byte) (response OfficialFilesResponse, err error) {
+	err = json.Unmarshal(bytes, &response)
+	return
+}
+
+// Files returns the files (and directories, ending with "/") of the official package pkg.
+func (repo OfficialRepo) Files(conf Conf, pkg Package) (files []string, err error) {
+	arch := pkg.Arch
+	if arch == "" {
+		arch = conf.arch()
+	}
+	bytes, err := repo.FilesRaw(conf, pkg.Repo, arch, pkg.Name)
+	if err != nil {
+		return
+	}
+	res, err := repo.ParseFilesResponse(bytes)
+	if err != nil {
+		return
+	}
+	files = res.Files
+	return
+}
+
+// FileMatch is a file owned by a package.
+type FileMatch struct {
+	Repo    string `json:"repo"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Path    string `json:"path"`
+}
+
+// NewFileMatcher returns a function reporting whether a file path (as stored in the databases,
+// without the leading "/") matches query. Like pacman -F, a query containing "/" must match
+// the full path and any other query the file name; with regex, query is a regular expression
+// matched against the full path.
+func NewFileMatcher(query string, regex bool) (match func(filePath string) bool, err error) {
+	if regex {
+		var re *regexp.Regexp
+		re, err = regexp.Compile(query)
+		if err != nil {
+			return
+		}
+		match = func(filePath string) bool { return !strings.HasSuffix(filePath, "/") && re.MatchString("/"+filePath) }
+		return
+	}
+	if strings.Contains(query, "/") {
+		query = strings.TrimPrefix(query, "/")
+		match = func(filePath string) bool { return filePath == query }
+		return
+	}
+	match = func(filePath string) bool {
+		return !strings.HasSuffix(filePath, "/") && path.Base(filePath) == query
+	}
+	return
+}
+
+func appendFileMatches(matches []FileMatch, pkg Package, files []string, match func(string) bool) []FileMatch {
+	for _, filePath := range files {
+		if match(filePath) {
+			matches = append(matches, FileMatch{Repo: pkg.Repo, Name: pkg.Name, Version: pkg.Version, Path: filePath})
+		}
+	}
+	return matches
+}
+
+// SearchFilesDBs searches the files databases (<dbpath>/sync/*.files).
+func SearchFilesDBs(conf Conf, match func(string) bool) (matches []FileMatch, err error) {
+	dbFilePaths, err := syncDBPaths(conf, ".files")
+	if err != nil {
+		return
+	}
+	if len(dbFilePaths) == 0 {
+		err = errors.New("no files database in " + path.Join(conf.dbPath(), "sync") + " (run pacman -Fy or use --remote)")
+		return
+	}
+	for _, dbFilePath := range dbFilePaths {
+		var db SyncDB
+		db, err = ReadSyncDB(dbFilePath)
+		if err != nil {
+			return
+		}
+		for _, pkg := range db.Packages {
+			matches = appendFileMatches(matches, pkg, pkg.Files, match)
+		}
+	}
+	return
+}
+
+// RemoteFileCandidates is the maximum number of packages whose file lists SearchFilesRemote fetches.
+const RemoteFileCandidates = 20
+
+// SearchFilesRemote searches the file lists of the official web API. As the API cannot be searched
+// by file, only the packages found by searching the file name (without extension) are checked.
+func SearchFilesRemote(conf Conf, query string, match func(string) bool) (matches []FileMatch, err error) {
+	if conf.RegexFlag {
+		err = errors.New("remote file search needs a file name, not a regular expression")
+		return
+	}
+	word := path.Base(query)
+	if i := strings.Index(word, "."); i > 0 {
+		word = word[:i]
+	}
+	c := conf
+	c.Args = []string{word}
+	c.SearchBy = ""
+	c.Limit = RemoteFileCandidates
+	repo := OfficialRepo{}
+	pkgs, err := repo.Search(c)
+	var truncated *TruncatedError
+	if errors.As(err, &truncated) {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	for _, pkg := range pkgs {
+		var files []string
+		files, err = repo.Files(conf, pkg)
+		if err != nil {
+			return
+		}
+		matches = appendFileMatches(matches, pkg, files, match)
+	}
+	return
+}
+
+// SearchFiles finds the packages owning the file conf.Args[0] in the files databases,
+// or with the official web API if conf.RemoteFlag is set.
+func SearchFiles(conf Conf) (matches []FileMatch, err error) {
+	if len(conf.Args) == 0 {
+		err = errors.New("please specify a file")
+		return
+	}
+	query := conf.Args[0]
+	match, err := NewFileMatcher(query, conf.RegexFlag)
+	if err != nil {
+		return
+	}
+	if conf.RemoteFlag {
+		matches, err = SearchFilesRemote(conf, query, match)
+		return
+	}
+	matches, err = SearchFilesDBs(conf, match)
+	return
+}
+
+// FileList is the content of a package.
+type FileList struct {
+	Repo          string   `json:"repo"`
+	Name          string   `json:"name"`
+	Version       string   `json:"version"`
+	InstalledSize int64    `json:"installed_size,omitempty"`
+	FilesCount    int      `json:"files_count"`
+	DirCount      int      `json:"dir_count"`
+	Files         []string `json:"files"`
+}
+
+func newFileList(pkg Package, files []string) (list FileList) {
+	list = FileList{Repo: pkg.Repo, Name: pkg.Name, Version: pkg.Version, InstalledSize: pkg.InstalledSize, Files: files}
+	if list.Files == nil {
+		list.Files = []string{}
+	}
+	// count the parent directories too, as they are not always listed
+	dirs := make(map[string]bool)
+	for _, filePath := range files {
+		if !strings.HasSuffix(filePath, "/") {
+			list.FilesCount++
+		}
+		for i, c := range filePath {
+			if c == '/' {
+				dirs[filePath[:i+1]] = true
+			}
+		}
+	}
+	list.DirCount = len(dirs)
+	return
+}
+
+// ListFiles lists the files of the package conf.Args[0] ("name" or "repo/name") with the
+// official web API, or with the files databases if conf.SyncDBFlag is set.
+func ListFiles(conf Conf) (list FileList, err error) {
+	if len(conf.Args) == 0 {
+		err = errors.New("please specify package name")
+		return
+	}
+	if !conf.SyncDBFlag {
+		repo := OfficialRepo{}
+		var pkg Package
+		pkg, err = repo.Info(conf)
+		if err != nil {
+			return
+		}
+		var files []string
+		files, err = repo.Files(conf, pkg)
+		if err != nil {
+			return
+		}
+		list = newFileList(pkg, files)
+		return
+	}
+	repoName, name := "", conf.Args[0]
+	if i := strings.Index(name, "/"); i >= 0 {
+		repoName, name = CanonicalRepoName(name[:i]), name[i+1:]
+	}
+	dbFilePaths, err := syncDBPaths(conf, ".files")
+	if err != nil {
+		return
+	}
+	for _, dbFilePath := range dbFilePaths {
+		// skip the other repositories before decompressing them
+		if repoName != "" && strings.TrimSuffix(filepath.Base(dbFilePath), ".files") != repoName {
+			continue
+		}
+		var db SyncDB
+		db, err = ReadSyncDB(dbFilePath)
+		if err != nil {
+			return
+		}
+		for _, pkg := range db.Packages {
+			if pkg.Name == name {
+				list = newFileList(pkg, pkg.Files)
+				return
+			}
+		}
+	}
+	err = ErrNotFound
+	return
+}
+
+type fileTreeNode struct {
+	name     string
+	children []*fileTreeNode
+}
+
+func (node *fileTreeNode) child(name string) *fileTreeNode {
+	for _, c := range node.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &fileTreeNode{name: name}
+	node.children = append(node.children, c)
+	return c
+}
+
+// WriteTree writes the files as a tree (like tree(1)) followed by the counts and the installed size.
+func (list FileList) WriteTree(w io.Writer) (err error) {
+	root := &fileTreeNode{name: "/"}
+	for _, filePath := range list.Files {
+		node := root
+		parts := strings.SplitAfter(filePath, "/")
+		for _, part := range parts {
+			if part != "" {
+				node = node.child(part)
+			}
+		}
+	}
+	var write func(node *fileTreeNode, prefix string) error
+	write = func(node *fileTreeNode, prefix string) error {
+		for i, c := range node.children {
+			branch, indent := "├── ", "│   "
+			if i == len(node.children)-1 {
+				branch, indent = "└── ", "    "
+			}
+			if _, err := fmt.Fprintln(w, prefix+branch+c.name); err != nil {
+				return err
+			}
+			if err := write(c, prefix+indent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	_, err = fmt.Fprintln(w, root.name)
+	if err != nil {
+		return
+	}
+	err = write(root, "")
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(w, "\n%d directories, %d files", list.DirCount, list.FilesCount)
+	if err == nil && list.InstalledSize != 0 {
+		_, err = fmt.Fprintf(w, ", %s installed", bytefmt.ByteSize(uint64(list.InstalledSize)))
+	}
+	if err == nil {
+		_, err = fmt.Fprintln(w)
+	}
+	return
+}
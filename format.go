@@ -0,0 +1,308 @@
+package srchway
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Formatter renders packages returned by Repo.Search and Repo.Info.
+type Formatter interface {
+	FormatSearch(w io.Writer, pkgs []Package) error
+	FormatInfo(w io.Writer, pkgs []Package) error
+}
+
+const DefaultFormat = "pacman"
+
+var formatters = map[string]Formatter{
+	"pacman":  PacmanFormatter{},
+	"compact": CompactFormatter{},
+	"table":   TableFormatter{},
+	"json":    JSONFormatter{},
+	"yaml":    YAMLFormatter{},
+	"csv":     CSVFormatter{},
+}
+
+// FormatNames returns the names accepted by NewFormatter (besides templates).
+func FormatNames() []string {
+	return []string{"pacman", "compact", "table", "json", "yaml", "csv"}
+}
+
+// NewFormatter returns the formatter called name.
+// A name containing "{{" is parsed as a text/template executed for each package.
+func NewFormatter(name string) (formatter Formatter, err error) {
+	if name == "" {
+		name = DefaultFormat
+	}
+	if strings.Contains(name, "{{") {
+		formatter, err = NewTemplateFormatter(name)
+		return
+	}
+	formatter, ok := formatters[name]
+	if !ok {
+		err = errors.New("unknown format: " + name + " (available: " + strings.Join(FormatNames(), ", ") + ")")
+	}
+	return
+}
+
+// Formatter returns the formatter selected by conf.Format (or conf.JsonFlag).
+func (conf Conf) Formatter() (formatter Formatter, err error) {
+	if conf.JsonFlag {
+		return JSONFormatter{}, nil
+	}
+	return NewFormatter(conf.Format)
+}
+
+func PrintPackages(conf Conf, pkgs []Package) (err error) {
+	formatter, err := conf.Formatter()
+	if err != nil {
+		return
+	}
+	err = formatter.FormatSearch(os.Stdout, pkgs)
+	return
+}
+
+func PrintPackageInfo(conf Conf, pkgs ...Package) (err error) {
+	formatter, err := conf.Formatter()
+	if err != nil {
+		return
+	}
+	err = formatter.FormatInfo(os.Stdout, pkgs)
+	return
+}
+
+// PacmanFormatter mimics the output of pacman -Ss and pacman -Si.
+type PacmanFormatter struct{}
+
+func (f PacmanFormatter) FormatSearch(w io.Writer, pkgs []Package) (err error) {
+	for _, pkg := range pkgs {
+		color.New(color.FgBlue).Add(color.Bold).Fprint(w, pkg.Repo)
+		color.New(color.Bold).Fprintf(w, "/%s ", pkg.Name)
+		if pkg.OutOfDate {
+			color.New(color.FgRed).Add(color.Bold).Fprint(w, pkg.Version)
+		} else {
+			color.New(color.Bold).Fprint(w, pkg.Version)
+		}
+		if pkg.IsUser() {
+			fmt.Fprintf(w, " (%d)", pkg.Votes)
+		}
+		if pkg.Shadows != "" {
+			color.New(color.FgYellow).Fprintf(w, " [shadows %s]", pkg.Shadows)
+		}
+		fmt.Fprintln(w)
+		_, err = fmt.Fprintf(w, "    %s\n", pkg.Description)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+type infoRow struct {
+	label string
+	value string
+}
+
+func infoRows(pkg Package) (rows []infoRow) {
+	rows = []infoRow{
+		{"Repository", pkg.Repo},
+		{"Name", pkg.Name},
+		{"Version", pkg.Version},
+		{"Description", pkg.Description},
+	}
+	if !pkg.IsUser() {
+		rows = append(rows, infoRow{"Architecture", pkg.Arch})
+	}
+	rows = append(rows, []infoRow{
+		{"URL", pkg.URL},
+		{"Licenses", joinOrNoneString(pkg.Licenses)},
+		{"Groups", joinOrNoneString(pkg.Groups)},
+		{"Provides", joinOrNoneString(pkg.Provides)},
+		{"Depends On", joinOrNoneString(pkg.Depends)},
+		{"Optional Deps", joinOrNoneStringForOptDepends(pkg.OptDepends)},
+		{"Make Deps", joinOrNoneString(pkg.MakeDepends)},
+		{"Check Deps", joinOrNoneString(pkg.CheckDepends)},
+	}...)
+	// only known when the sync databases are available
+	if pkg.RequiredBy != nil {
+		rows = append(rows, []infoRow{
+			{"Required By", joinOrNoneString(pkg.RequiredBy)},
+			{"Optional For", joinOrNoneString(pkg.OptionalFor)},
+		}...)
+	}
+	rows = append(rows, []infoRow{
+		{"Conflicts With", joinOrNoneString(pkg.Conflicts)},
+		{"Replaces", joinOrNoneString(pkg.Replaces)},
+	}...)
+	if pkg.IsUser() {
+		rows = append(rows, []infoRow{
+			{"Maintainer", joinOrNoneString(pkg.Maintainers)},
+			{"Submitted", pkg.FirstSubmitted.String()},
+			{"Last Modified", pkg.LastModified.String()},
+			{"Snapshot", pkg.SnapshotURL},
+			{"Votes", strconv.Itoa(pkg.Votes)},
+		}...)
+	} else {
+		rows = append(rows, []infoRow{
+			{"Download Size", bytefmt.ByteSize(uint64(pkg.CompressedSize))},
+			{"Installed Size", bytefmt.ByteSize(uint64(pkg.InstalledSize))},
+			{"Packager", pkg.Packager},
+			{"Build Date", pkg.BuildDate.String()},
+		}...)
+	}
+	return
+}
+
+func (f PacmanFormatter) FormatInfo(w io.Writer, pkgs []Package) (err error) {
+	for i, pkg := range pkgs {
+		if i != 0 {
+			fmt.Fprintln(w)
+		}
+		for _, row := range infoRows(pkg) {
+			color.New(color.Bold).Fprintf(w, "%-16s:", row.label)
+			_, err = fmt.Fprintf(w, " %s\n", row.value)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// CompactFormatter prints one line per package.
+type CompactFormatter struct{}
+
+func (f CompactFormatter) FormatSearch(w io.Writer, pkgs []Package) (err error) {
+	for _, pkg := range pkgs {
+		_, err = fmt.Fprintf(w, "%s %s - %s\n", pkg.FullName(), pkg.Version, pkg.Description)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (f CompactFormatter) FormatInfo(w io.Writer, pkgs []Package) error {
+	return f.FormatSearch(w, pkgs)
+}
+
+var tableColumns = []string{"repo", "name", "version", "out_of_date", "votes", "description"}
+
+func tableRecord(pkg Package) []string {
+	return []string{pkg.Repo, pkg.Name, pkg.Version, strconv.FormatBool(pkg.OutOfDate),
+		strconv.Itoa(pkg.Votes), pkg.Description}
+}
+
+// TableFormatter prints aligned columns with a header.
+type TableFormatter struct{}
+
+func (f TableFormatter) FormatSearch(w io.Writer, pkgs []Package) (err error) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(tableColumns, "\t")))
+	for _, pkg := range pkgs {
+		fmt.Fprintln(tw, strings.Join(tableRecord(pkg), "\t"))
+	}
+	err = tw.Flush()
+	return
+}
+
+func (f TableFormatter) FormatInfo(w io.Writer, pkgs []Package) error {
+	return f.FormatSearch(w, pkgs)
+}
+
+// CSVFormatter prints RFC 4180 CSV with a header.
+type CSVFormatter struct{}
+
+func (f CSVFormatter) FormatSearch(w io.Writer, pkgs []Package) (err error) {
+	cw := csv.NewWriter(w)
+	cw.Write(tableColumns)
+	for _, pkg := range pkgs {
+		cw.Write(tableRecord(pkg))
+	}
+	cw.Flush()
+	err = cw.Error()
+	return
+}
+
+func (f CSVFormatter) FormatInfo(w io.Writer, pkgs []Package) error {
+	return f.FormatSearch(w, pkgs)
+}
+
+// JSONFormatter prints an indented JSON array.
+type JSONFormatter struct{}
+
+func (f JSONFormatter) FormatSearch(w io.Writer, pkgs []Package) (err error) {
+	bytes, err := json.MarshalIndent(pkgs, "", "  ")
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintln(w, string(bytes))
+	return
+}
+
+func (f JSONFormatter) FormatInfo(w io.Writer, pkgs []Package) error {
+	return f.FormatSearch(w, pkgs)
+}
+
+// YAMLFormatter prints a YAML sequence using the same keys as JSONFormatter.
+type YAMLFormatter struct{}
+
+func (f YAMLFormatter) FormatSearch(w io.Writer, pkgs []Package) (err error) {
+	// go through JSON so that the keys and time formats match the JSON output
+	bytes, err := json.Marshal(pkgs)
+	if err != nil {
+		return
+	}
+	var v interface{}
+	err = json.Unmarshal(bytes, &v)
+	if err != nil {
+		return
+	}
+	bytes, err = yaml.Marshal(v)
+	if err != nil {
+		return
+	}
+	_, err = w.Write(bytes)
+	return
+}
+
+func (f YAMLFormatter) FormatInfo(w io.Writer, pkgs []Package) error {
+	return f.FormatSearch(w, pkgs)
+}
+
+// TemplateFormatter executes a text/template for each package.
+type TemplateFormatter struct {
+	tmpl *template.Template
+}
+
+func NewTemplateFormatter(text string) (f TemplateFormatter, err error) {
+	funcs := template.FuncMap{"join": strings.Join}
+	f.tmpl, err = template.New("format").Funcs(funcs).Parse(text)
+	return
+}
+
+func (f TemplateFormatter) FormatSearch(w io.Writer, pkgs []Package) (err error) {
+	for _, pkg := range pkgs {
+		err = f.tmpl.Execute(w, pkg)
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(w)
+	}
+	return
+}
+
+func (f TemplateFormatter) FormatInfo(w io.Writer, pkgs []Package) error {
+	return f.FormatSearch(w, pkgs)
+}
@@ -0,0 +1,19 @@
+module github.com/taskie/srchway
+
+go 1.23.0
+
+require (
+	code.cloudfoundry.org/bytefmt v0.0.0-20200131002437-cf55d5288a48
+	github.com/fatih/color v1.9.0
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/crypto v0.21.0
+	gopkg.in/yaml.v2 v2.4.0
+	mvdan.cc/sh/v3 v3.12.0
+)
+
+require (
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+)
@@ -0,0 +1,180 @@
+package srchway
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GraphNode is a package of a dependency graph.
+type GraphNode struct {
+	Name    string `json:"name"`
+	Repo    string `json:"repo,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Missing is set if no package satisfies the dependency.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// GraphEdge is a dependency of a node on another one.
+type GraphEdge struct {
+	To string `json:"to"`
+	// Kind is "depends", "makedepends", "checkdepends" or "optdepends".
+	Kind string `json:"kind"`
+	// Dep is the dependency as written in the package (e.g. "python>=3").
+	Dep string `json:"dep"`
+}
+
+// Graph is a dependency graph as an adjacency list.
+type Graph struct {
+	Nodes []GraphNode            `json:"nodes"`
+	Edges map[string][]GraphEdge `json:"edges"`
+}
+
+type graphDeps struct {
+	kind string
+	deps []string
+}
+
+// graphDepKinds lists the dependency fields of a package by kind.
+func graphDepKinds(pkg Package) []graphDeps {
+	return []graphDeps{
+		{"depends", pkg.Depends},
+		{"makedepends", pkg.MakeDepends},
+		{"checkdepends", pkg.CheckDepends},
+		{"optdepends", pkg.OptDepends},
+	}
+}
+
+// BuildGraph walks the dependencies of the packages called names, looking them up in the official
+// repositories and then, if conf.AurFlag is set, in the AUR. Only depends are followed, up to
+// depth levels (no limit if depth <= 0); make, check and optional dependencies are added as leaves.
+func BuildGraph(conf Conf, names []string, depth int) (graph Graph, err error) {
+	r := NewResolver(conf)
+	graph.Nodes = make([]GraphNode, 0)
+	graph.Edges = make(map[string][]GraphEdge)
+	pkgs := make(map[string]Package)
+	// resolved maps a dependency name to the node satisfying it
+	resolved := make(map[string]string)
+
+	lookup := func(depString string) (name string, err error) {
+		dep := ParseDependency(depString)
+		if name, ok := resolved[dep.Name]; ok {
+			return name, nil
+		}
+		pkg, ok, err := r.lookupOfficial(dep)
+		if err != nil {
+			return
+		}
+		if !ok && conf.AurFlag {
+			pkg, ok, err = r.lookupUser(dep, r.canCheckProvides())
+			if err != nil {
+				return
+			}
+		}
+		if !ok {
+			name = dep.Name
+			resolved[dep.Name] = name
+			graph.Nodes = append(graph.Nodes, GraphNode{Name: name, Missing: true})
+			return
+		}
+		name = pkg.Name
+		resolved[dep.Name] = name
+		if _, ok := pkgs[name]; !ok {
+			pkgs[name] = pkg
+			graph.Nodes = append(graph.Nodes, GraphNode{Name: name, Repo: pkg.Repo, Version: pkg.Version})
+		}
+		return
+	}
+
+	var queue []string
+	level := make(map[string]int)
+	for _, name := range names {
+		var nodeName string
+		nodeName, err = lookup(name)
+		if err != nil {
+			return
+		}
+		if _, ok := level[nodeName]; !ok {
+			level[nodeName] = 0
+			queue = append(queue, nodeName)
+		}
+	}
+	for len(queue) != 0 {
+		name := queue[0]
+		queue = queue[1:]
+		pkg, ok := pkgs[name]
+		if !ok || (depth > 0 && level[name] >= depth) {
+			continue
+		}
+		for _, kind := range graphDepKinds(pkg) {
+			for _, depString := range kind.deps {
+				var to string
+				to, err = lookup(depString)
+				if err != nil {
+					return
+				}
+				graph.Edges[name] = append(graph.Edges[name], GraphEdge{To: to, Kind: kind.kind, Dep: depString})
+				if _, seen := level[to]; !seen && kind.kind == "depends" {
+					level[to] = level[name] + 1
+					queue = append(queue, to)
+				}
+			}
+		}
+	}
+	return
+}
+
+// graphRepoColors maps repositories to the fill colours of their nodes in DOT output.
+var graphRepoColors = map[string]string{
+	UserRepoName: "lightblue",
+	"core":       "lightcoral",
+	"extra":      "khaki",
+	"multilib":   "plum",
+}
+
+// graphKindStyles maps dependency kinds to edge attributes in DOT output.
+var graphKindStyles = map[string][]string{
+	"makedepends":  {"style=dashed", "color=blue"},
+	"checkdepends": {"style=dashed", "color=darkgreen"},
+	"optdepends":   {"style=dotted", "color=gray40", "arrowhead=empty"},
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language.
+func (graph Graph) WriteDOT(w io.Writer) (err error) {
+	lines := []string{"digraph dependencies {", "\tnode [shape=box, style=filled, fillcolor=white];"}
+	for _, node := range graph.Nodes {
+		attrs := fmt.Sprintf("label=%q", node.Name+"\n"+node.Version)
+		switch {
+		case node.Missing:
+			attrs = fmt.Sprintf("label=%q, color=red, fontcolor=red", node.Name+"\n(missing)")
+		case graphRepoColors[node.Repo] != "":
+			attrs += ", fillcolor=" + graphRepoColors[node.Repo]
+		default:
+			attrs += ", fillcolor=palegreen"
+		}
+		lines = append(lines, fmt.Sprintf("\t%q [%s];", node.Name, attrs))
+	}
+	froms := make([]string, 0, len(graph.Edges))
+	for from := range graph.Edges {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	for _, from := range froms {
+		for _, edge := range graph.Edges[from] {
+			attrs := graphKindStyles[edge.Kind]
+			// label the edges whose dependency is versioned or satisfied by another name
+			if dep := ParseDependency(edge.Dep); dep.Name != edge.To || dep.Op != "" {
+				attrs = append(append([]string{}, attrs...), fmt.Sprintf("label=%q", dep.Name+dep.Op+dep.Version))
+			}
+			line := fmt.Sprintf("\t%q -> %q", from, edge.To)
+			if len(attrs) != 0 {
+				line += " [" + strings.Join(attrs, ", ") + "]"
+			}
+			lines = append(lines, line+";")
+		}
+	}
+	lines = append(lines, "}")
+	_, err = fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return
+}
@@ -0,0 +1,206 @@
+package srchway
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDBPath is the default pacman database directory.
+const DefaultDBPath = "/var/lib/pacman"
+
+// LocalRepoName is the repository name used for installed packages.
+const LocalRepoName = "local"
+
+func (conf Conf) dbPath() string {
+	if conf.DBPath != "" {
+		return conf.DBPath
+	}
+	return DefaultDBPath
+}
+
+// ParseDesc parses a pacman database "desc" file into its %KEY% sections.
+func ParseDesc(r io.Reader) (fields map[string][]string, err error) {
+	fields = make(map[string][]string)
+	scanner := bufio.NewScanner(r)
+	key := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			key = ""
+		case key == "" && len(line) > 2 && strings.HasPrefix(line, "%") && strings.HasSuffix(line, "%"):
+			key = line[1 : len(line)-1]
+			fields[key] = []string{}
+		case key != "":
+			fields[key] = append(fields[key], line)
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// DescPackage converts the fields of a "desc" file to a Package of the repository repo.
+func DescPackage(repo string, fields map[string][]string) (pkg Package) {
+	value := func(key string) string {
+		if len(fields[key]) == 0 {
+			return ""
+		}
+		return fields[key][0]
+	}
+	size := func(key string) int64 {
+		n, _ := strconv.ParseInt(value(key), 10, 64)
+		return n
+	}
+	pkg = Package{
+		Repo:           repo,
+		Name:           value("NAME"),
+		Base:           value("BASE"),
+		Version:        value("VERSION"),
+		Epoch:          ParseEpoch(value("VERSION")),
+		Description:    value("DESC"),
+		URL:            value("URL"),
+		Arch:           value("ARCH"),
+		Licenses:       fields["LICENSE"],
+		Groups:         fields["GROUPS"],
+		Depends:        fields["DEPENDS"],
+		MakeDepends:    fields["MAKEDEPENDS"],
+		CheckDepends:   fields["CHECKDEPENDS"],
+		OptDepends:     fields["OPTDEPENDS"],
+		Provides:       fields["PROVIDES"],
+		Conflicts:      fields["CONFLICTS"],
+		Replaces:       fields["REPLACES"],
+		Files:          fields["FILES"],
+		Packager:       value("PACKAGER"),
+		FileName:       value("FILENAME"),
+		CompressedSize: size("CSIZE"),
+		InstalledSize:  size("ISIZE"),
+	}
+	if pkg.InstalledSize == 0 {
+		pkg.InstalledSize = size("SIZE")
+	}
+	if sec := size("BUILDDATE"); sec != 0 {
+		pkg.BuildDate = time.Unix(sec, 0)
+	}
+	if pkg.Base == "" {
+		pkg.Base = pkg.Name
+	}
+	return
+}
+
+// ReadLocalPackages reads the packages installed according to <dbpath>/local.
+func ReadLocalPackages(conf Conf) (pkgs []Package, err error) {
+	localDir := filepath.Join(conf.dbPath(), "local")
+	entries, err := ioutil.ReadDir(localDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		var file *os.File
+		file, err = os.Open(filepath.Join(localDir, entry.Name(), "desc"))
+		if err != nil {
+			return
+		}
+		var fields map[string][]string
+		fields, err = ParseDesc(file)
+		file.Close()
+		if err != nil {
+			return
+		}
+		pkgs = append(pkgs, DescPackage(LocalRepoName, fields))
+	}
+	return
+}
+
+// SyncPackageNames returns the names of the packages in the sync databases (<dbpath>/sync/*.db).
+func SyncPackageNames(conf Conf) (names map[string]bool, err error) {
+	conf.RepoNames = nil
+	// without sync databases every installed package would look foreign
+	dbs, err := LoadSyncDBs(conf)
+	if err != nil {
+		return
+	}
+	names = make(map[string]bool)
+	for _, db := range dbs {
+		for _, pkg := range db.Packages {
+			names[pkg.Name] = true
+		}
+	}
+	return
+}
+
+// ForeignPackages returns the installed packages found in no sync database (like pacman -Qm).
+func ForeignPackages(conf Conf) (pkgs []Package, err error) {
+	locals, err := ReadLocalPackages(conf)
+	if err != nil {
+		return
+	}
+	names, err := SyncPackageNames(conf)
+	if err != nil {
+		return
+	}
+	for _, pkg := range locals {
+		if !names[pkg.Name] {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	return
+}
+
+// Update describes the AUR state of an installed foreign package.
+type Update struct {
+	Local  Package `json:"local"`
+	Remote Package `json:"remote"`
+	// Newer is set if the AUR version is newer than the installed one.
+	Newer bool `json:"newer"`
+	// OutOfDate is set if the AUR package is flagged out-of-date.
+	OutOfDate bool `json:"out_of_date"`
+	// Orphaned is set if the AUR package has no maintainer.
+	Orphaned bool `json:"orphaned"`
+	// Deleted is set if the package is not in the AUR (anymore).
+	Deleted bool `json:"deleted"`
+}
+
+// CheckUpdates compares the installed foreign packages with the AUR and returns
+// those which are newer, flagged out-of-date, orphaned or deleted.
+func CheckUpdates(conf Conf) (updates []Update, err error) {
+	foreign, err := ForeignPackages(conf)
+	if err != nil || len(foreign) == 0 {
+		return
+	}
+	names := make([]string, 0, len(foreign))
+	for _, pkg := range foreign {
+		names = append(names, pkg.Name)
+	}
+	remotes, err := UserRepo{}.MultiInfo(conf, names)
+	if err != nil {
+		return
+	}
+	byName := make(map[string]Package)
+	for _, pkg := range remotes {
+		byName[pkg.Name] = pkg
+	}
+	for _, local := range foreign {
+		remote, ok := byName[local.Name]
+		update := Update{Local: local, Remote: remote, Deleted: !ok}
+		if ok {
+			update.Newer = VerCmp(remote.Version, local.Version) > 0
+			update.OutOfDate = remote.OutOfDate
+			update.Orphaned = len(remote.Maintainers) == 0
+		}
+		if update.Newer || update.OutOfDate || update.Orphaned || update.Deleted {
+			updates = append(updates, update)
+		}
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package srchway
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeSyncDB writes <dbPath>/sync/<repoName>.db with a desc entry per package; each package
+// is given as "%KEY%" sections (NAME and VERSION are required).
+func writeSyncDB(t *testing.T, dbPath string, repoName string, descs ...map[string][]string) {
+	t.Helper()
+	dir := filepath.Join(dbPath, "sync")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(filepath.Join(dir, repoName+".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for _, desc := range descs {
+		var b strings.Builder
+		for key, values := range desc {
+			b.WriteString("%" + key + "%\n" + strings.Join(values, "\n") + "\n\n")
+		}
+		name := desc["NAME"][0] + "-" + desc["VERSION"][0] + "/desc"
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(b.Len())})
+		tw.Write([]byte(b.String()))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeLocalPackage(t *testing.T, dbPath string, name string, version string) {
+	t.Helper()
+	dir := filepath.Join(dbPath, "local", name+"-"+version)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	desc := "%NAME%\n" + name + "\n\n%VERSION%\n" + version + "\n\n"
+	if err := os.WriteFile(filepath.Join(dir, "desc"), []byte(desc), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForeignPackages(t *testing.T) {
+	dbPath := t.TempDir()
+	writeLocalPackage(t, dbPath, "glibc", "2.39-1")
+	writeLocalPackage(t, dbPath, "yay", "12.3.0-1")
+	conf := Conf{DBPath: dbPath}
+	if _, err := ForeignPackages(conf); err == nil {
+		t.Error("ForeignPackages() without sync databases = nil error")
+	}
+	writeSyncDB(t, dbPath, "core", map[string][]string{"NAME": {"glibc"}, "VERSION": {"2.39-1"}})
+	pkgs, err := ForeignPackages(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"yay"}) {
+		t.Errorf("ForeignPackages() = %q, want [yay]", names)
+	}
+}
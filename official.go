@@ -4,31 +4,41 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
-	"time"
 
-	"code.cloudfoundry.org/bytefmt"
 	"github.com/fatih/color"
-	"github.com/termie/go-shutil"
 )
 
 type OfficialRepo struct{}
 
 const OfficialBaseURL = "https://www.archlinux.org/packages"
-const OfficialCorePackageURL = "https://projects.archlinux.org/svntogit/packages.git/snapshot/packages"
-const OfficialCommunityPackageURL = "https://projects.archlinux.org/svntogit/community.git/snapshot/community-packages"
+const OfficialPackagingURL = "https://gitlab.archlinux.org/archlinux/packaging/packages"
+const OfficialPackagingRef = "main"
 
 type OfficialSearchResponse struct {
-	Version int
-	Limit   int
-	Valid   bool
-	Results []OfficialSearchResult
+	Version  int
+	Limit    int
+	Valid    bool
+	Page     int
+	NumPages int `json:"num_pages"`
+	Results  []OfficialSearchResult
+}
+
+// DefaultSearchLimit is the maximum number of official packages Search returns if Conf.Limit is not set.
+const DefaultSearchLimit = 1000
+
+// TruncatedError is returned along with the results when a search has more results than the limit.
+type TruncatedError struct {
+	Limit int
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("results truncated to %d packages (use --limit to show more)", e.Limit)
 }
 
 type OfficialSearchResult struct {
@@ -37,6 +47,9 @@ type OfficialSearchResult struct {
 	CompressedSize int    `json:"compressed_size"`
 	Conflicts      []string
 	Depends        []string
+	OptDepends     []string
+	MakeDepends    []string
+	CheckDepends   []string
 	Epoch          int
 	FileName       string
 	FlagDate       string `json:"flag_date"`
@@ -57,34 +70,47 @@ type OfficialSearchResult struct {
 	Url            string
 }
 
+// officialSearchKeys maps the supported values of Conf.SearchBy to query parameters.
+var officialSearchKeys = map[string]string{
+	"":          "q",
+	"name-desc": "q",
+	"name":      "name",
+	"desc":      "desc",
+}
+
 func (repo OfficialRepo) BuildSearchQueryItems(conf Conf) (queryItems []QueryItem) {
-	repoNames := []string{"Core", "Extra", "Community"}
-	if conf.TestingFlag {
-		repoNames = append(repoNames, "Testing", "Community-Testing")
+	key, ok := officialSearchKeys[conf.SearchBy]
+	if !ok {
+		key = "q"
 	}
-	if conf.MultilibFlag {
-		repoNames = append(repoNames, "Multilib")
-		if conf.TestingFlag {
-			repoNames = append(repoNames, "Multilib-Testing")
-		}
+	queryItems = repo.buildQueryItems(conf, key, conf.Args)
+	return
+}
+
+func (repo OfficialRepo) buildQueryItems(conf Conf, key string, values []string) (queryItems []QueryItem) {
+	queryItems = []QueryItem{{Key: "arch", Values: []string{conf.arch()}}}
+	if conf.arch() != "any" {
+		queryItems = append(queryItems, QueryItem{Key: "arch", Values: []string{"any"}})
 	}
-	queryItems = []QueryItem{{Key: "arch", Values: []string{"x86_64"}}}
-	for _, repoName := range repoNames {
-		queryItems = append(queryItems, QueryItem{Key: "repo", Values: []string{repoName}})
+	for _, info := range conf.officialRepos() {
+		queryItems = append(queryItems, QueryItem{Key: "repo", Values: []string{info.APIName}})
 	}
-	queryItems = append(queryItems, QueryItem{Key: "q", Values: conf.Args})
+	queryItems = append(queryItems, QueryItem{Key: key, Values: values})
 	return
 }
 
-func (repo OfficialRepo) Search(conf Conf) (bytes []byte, err error) {
-	queryItems := repo.BuildSearchQueryItems(conf)
-	url := OfficialBaseURL + "/search/json/?" + BuildQueryString(queryItems)
-	resp, err := http.Get(url)
-	if err != nil {
+func (repo OfficialRepo) searchRaw(conf Conf, queryItems []QueryItem) (bytes []byte, err error) {
+	url := repo.BaseURL(conf) + "/search/json/?" + BuildQueryString(queryItems)
+	bytes, err = httpGet(conf, url)
+	return
+}
+
+func (repo OfficialRepo) SearchRaw(conf Conf) (bytes []byte, err error) {
+	if _, ok := officialSearchKeys[conf.SearchBy]; !ok {
+		err = errors.New("official repositories cannot be searched by " + conf.SearchBy)
 		return
 	}
-	defer resp.Body.Close()
-	bytes, err = ioutil.ReadAll(resp.Body)
+	bytes, err = repo.searchRaw(conf, repo.BuildSearchQueryItems(conf))
 	return
 }
 
@@ -93,42 +119,122 @@ func (repo OfficialRepo) ParseSearchResponse(bytes []byte) (response OfficialSea
 	return
 }
 
-func (repo OfficialRepo) PrintSearchResponse(conf Conf) (err error) {
-	bytes, err := repo.Search(conf)
-	if err != nil {
-		return
-	}
-	if conf.JsonFlag {
-		fmt.Println(string(bytes[:]))
-	} else {
-		res, err := repo.ParseSearchResponse(bytes)
+// search fetches the pages of the search result until limit packages are found (no limit if limit <= 0).
+func (repo OfficialRepo) search(conf Conf, queryItems []QueryItem, limit int) (pkgs []Package, truncated bool, err error) {
+	pkgs = make([]Package, 0)
+	for page := 1; ; page++ {
+		items := queryItems
+		if page > 1 {
+			items = append(append([]QueryItem{}, queryItems...), QueryItem{Key: "page", Values: []string{strconv.Itoa(page)}})
+		}
+		var bytes []byte
+		bytes, err = repo.searchRaw(conf, items)
+		if err != nil {
+			return
+		}
+		var res OfficialSearchResponse
+		res, err = repo.ParseSearchResponse(bytes)
 		if err != nil {
-			return err
+			return
+		}
+		for _, result := range res.Results {
+			if limit > 0 && len(pkgs) >= limit {
+				truncated = true
+				return
+			}
+			pkgs = append(pkgs, result.Package())
 		}
-		for _, pkg := range res.Results {
-			color.New(color.FgBlue).Add(color.Bold).Print(pkg.Repo)
-			color.New(color.Bold).Printf("/%s %s-%s\n", pkg.PkgName, pkg.PkgVer, pkg.PkgRel)
-			fmt.Printf("    %s\n", pkg.PkgDesc)
+		if page >= res.NumPages || len(res.Results) == 0 {
+			return
 		}
+		if limit > 0 && len(pkgs) >= limit {
+			truncated = true
+			return
+		}
+	}
+}
+
+// Search returns up to conf.Limit (or DefaultSearchLimit) packages.
+// If there are more, the packages are returned with a *TruncatedError.
+func (repo OfficialRepo) Search(conf Conf) (pkgs []Package, err error) {
+	if _, ok := officialSearchKeys[conf.SearchBy]; !ok {
+		err = errors.New("official repositories cannot be searched by " + conf.SearchBy)
+		return
+	}
+	limit := conf.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	pkgs, truncated, err := repo.search(conf, repo.BuildSearchQueryItems(conf), limit)
+	if err == nil && truncated {
+		err = &TruncatedError{Limit: limit}
+	}
+	return
+}
+
+// SearchByName returns the packages named exactly name.
+func (repo OfficialRepo) SearchByName(conf Conf, name string) (pkgs []Package, err error) {
+	pkgs, _, err = repo.search(conf, repo.buildQueryItems(conf, "name", []string{name}), 0)
+	return
+}
+
+func (result OfficialSearchResult) Package() (pkg Package) {
+	pkg = Package{
+		Repo:           result.Repo,
+		Name:           result.PkgName,
+		Base:           result.PkgBase,
+		Version:        FormatVersion(result.Epoch, result.PkgVer, result.PkgRel),
+		Epoch:          result.Epoch,
+		Description:    result.PkgDesc,
+		URL:            result.Url,
+		Arch:           result.Arch,
+		Licenses:       result.Licenses,
+		Groups:         result.Groups,
+		Depends:        result.Depends,
+		MakeDepends:    result.MakeDepends,
+		CheckDepends:   result.CheckDepends,
+		OptDepends:     result.OptDepends,
+		Provides:       result.Provides,
+		Conflicts:      result.Conflicts,
+		Replaces:       result.Replaces,
+		Maintainers:    result.Maintainers,
+		Packager:       result.Packager,
+		FileName:       result.FileName,
+		CompressedSize: int64(result.CompressedSize),
+		InstalledSize:  int64(result.InstalledSize),
+		BuildDate:      parseTime(result.BuildDate),
+		LastModified:   parseTime(result.LastUpdate),
+		FlagDate:       parseTime(result.FlagDate),
+		OutOfDate:      result.FlagDate != "",
+	}
+	if pkg.Base == "" {
+		pkg.Base = pkg.Name
 	}
 	return
 }
 
 type OfficialInfoResponse OfficialSearchResult
 
-func (repo OfficialRepo) InfoFromPackage(repoName string, pkgName string) (bytes []byte, err error) {
-	url := OfficialBaseURL + fmt.Sprintf("/%s/x86_64/%s/json", repoName, pkgName)
-	resp, err := http.Get(url)
-	if err != nil {
-		return
+// InfoFromPackage fetches repoName/pkgName for conf.Arch, falling back to the "any" architecture.
+func (repo OfficialRepo) InfoFromPackage(conf Conf, repoName string, pkgName string) (bytes []byte, err error) {
+	bytes, err = repo.infoFromPackageArch(conf, repoName, conf.arch(), pkgName)
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound && conf.arch() != "any" {
+		if anyBytes, e := repo.infoFromPackageArch(conf, repoName, "any", pkgName); e == nil {
+			bytes, err = anyBytes, nil
+		}
 	}
-	defer resp.Body.Close()
-	bytes, err = ioutil.ReadAll(resp.Body)
+	return
+}
+
+func (repo OfficialRepo) infoFromPackageArch(conf Conf, repoName string, arch string, pkgName string) (bytes []byte, err error) {
+	url := repo.BaseURL(conf) + fmt.Sprintf("/%s/%s/%s/json", repoName, arch, pkgName)
+	bytes, err = httpGet(conf, url)
 	return
 }
 
 func (repo OfficialRepo) InfoFromSearch(conf Conf) (bytes []byte, err error) {
-	bytes, err = repo.Search(conf)
+	bytes, err = repo.SearchRaw(conf)
 	if err != nil {
 		return
 	}
@@ -144,10 +250,10 @@ func (repo OfficialRepo) InfoFromSearch(conf Conf) (bytes []byte, err error) {
 	}
 	switch len(results) {
 	case 0:
-		err = errors.New("not found")
+		err = ErrNotFound
 		return
 	case 1:
-		bytes, err = repo.InfoFromPackage(results[0].Repo, results[0].PkgName)
+		bytes, err = repo.infoFromPackageArch(conf, results[0].Repo, results[0].Arch, results[0].PkgName)
 		return
 	default:
 		names := []string{}
@@ -159,7 +265,7 @@ func (repo OfficialRepo) InfoFromSearch(conf Conf) (bytes []byte, err error) {
 	}
 }
 
-func (repo OfficialRepo) Info(conf Conf) (bytes []byte, err error) {
+func (repo OfficialRepo) InfoRaw(conf Conf) (bytes []byte, err error) {
 	if len(conf.Args) == 0 {
 		err = errors.New("please specify package name")
 		return
@@ -167,7 +273,7 @@ func (repo OfficialRepo) Info(conf Conf) (bytes []byte, err error) {
 	query := conf.Args[0]
 	if strings.Contains(query, "/") {
 		parts := strings.Split(query, "/")
-		bytes, err = repo.InfoFromPackage(parts[0], parts[1])
+		bytes, err = repo.InfoFromPackage(conf, CanonicalRepoName(parts[0]), parts[1])
 		return
 	}
 	bytes, err = repo.InfoFromSearch(conf)
@@ -179,102 +285,89 @@ func (repo OfficialRepo) ParseInfoResponse(bytes []byte) (response OfficialInfoR
 	return
 }
 
-func (repo OfficialRepo) PrintInfoResponse(conf Conf) (err error) {
-	bytes, err := repo.Info(conf)
+func (repo OfficialRepo) Info(conf Conf) (pkg Package, err error) {
+	bytes, err := repo.InfoRaw(conf)
 	if err != nil {
 		return
 	}
-	if conf.JsonFlag {
-		fmt.Println(string(bytes[:]))
-	} else {
-		res, err := repo.ParseInfoResponse(bytes)
-		if err != nil {
-			return err
-		}
-		str := `Repository      : %s
-Name            : %s
-Version         : %s-%s
-Description     : %s
-Architecture    : %s
-URL             : %s
-Licenses        : %s
-Groups          : %s
-Provides        : %s
-Depends On      : %s
-Optional Deps   : %s
-Conflicts With  : %s
-Replaces        : %s
-Download Size   : %s
-Installed Size  : %s
-Packager        : %s
-Build Date      : %s
-`
-		re := regexp.MustCompile("\\s*([^:]+:)([^\\n]*)\\n")
-		str = re.ReplaceAllString(str, "\x1b[1m$1\x1b[0m$2\n")
-		buildDate, _ := time.Parse(time.RFC3339, res.BuildDate)
-		deps := make([]string, 0)
-		optdeps := make([]string, 0)
-		for _, v := range res.Depends {
-			if strings.Contains(v, ":") {
-				optdeps = append(optdeps, v)
-			} else {
-				deps = append(deps, v)
-			}
-		}
-		fmt.Printf(str, res.Repo, res.PkgName, res.PkgVer, res.PkgRel, res.PkgDesc, res.Arch, res.Url,
-			joinOrNoneString(res.Licenses), joinOrNoneString(res.Groups), joinOrNoneString(res.Provides),
-			joinOrNoneString(deps), joinOrNoneStringForOptDepends(optdeps), joinOrNoneString(res.Conflicts), joinOrNoneString(res.Replaces),
-			bytefmt.ByteSize(uint64(res.CompressedSize)), bytefmt.ByteSize(uint64(res.InstalledSize)),
-			res.Packager, buildDate)
+	res, err := repo.ParseInfoResponse(bytes)
+	if err != nil {
+		return
 	}
+	pkg = OfficialSearchResult(res).Package()
 	return
 }
 
-func (repo OfficialRepo) GetInfoToDownload(conf Conf) (res OfficialInfoResponse, isCommunity bool, url string, err error) {
-	bytes, err := repo.Info(conf)
-	if err != nil {
-		return
+var packagingPathReplacers = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`([a-zA-Z0-9]+)\+([a-zA-Z]+)`), "$1-$2"},
+	{regexp.MustCompile(`\+`), "plus"},
+	{regexp.MustCompile(`[^a-zA-Z0-9_\-.]`), "-"},
+	{regexp.MustCompile(`[_\-]{2,}`), "-"},
+	{regexp.MustCompile(`^tree$`), "unix-tree"},
+}
+
+// PackagingProjectPath converts pkgbase to the GitLab project path (same rules as devtools).
+func PackagingProjectPath(pkgBase string) (projectPath string) {
+	projectPath = pkgBase
+	for _, r := range packagingPathReplacers {
+		projectPath = r.re.ReplaceAllString(projectPath, r.repl)
 	}
-	res, err = repo.ParseInfoResponse(bytes)
-	if err != nil {
-		return
+	return
+}
+
+func (repo OfficialRepo) BaseURL(conf Conf) string {
+	if conf.OfficialURL != "" {
+		return strings.TrimSuffix(conf.OfficialURL, "/")
 	}
-	switch res.Repo {
-	case "core", "extra", "testing":
-		isCommunity = false
-	default:
-		isCommunity = true
+	return OfficialBaseURL
+}
+
+// PackagingURL returns the base URL of the packaging repositories of the packages in repoName.
+func (repo OfficialRepo) PackagingURL(conf Conf, repoName string) string {
+	if conf.PackagingURL != "" {
+		return strings.TrimSuffix(conf.PackagingURL, "/")
 	}
-	if isCommunity {
-		url = OfficialCommunityPackageURL + "/" + res.PkgBase + ".tar.gz"
-	} else {
-		url = OfficialCorePackageURL + "/" + res.PkgBase + ".tar.gz"
+	if info, ok := LookupOfficialRepo(repoName); ok && info.PackagingURL != "" {
+		return info.PackagingURL
 	}
-	return
+	return OfficialPackagingURL
 }
 
-func (repo OfficialRepo) DownloadTarGz(conf Conf, url string, outDir string) (newOutFilePath string, err error) {
-	outFile, newOutFilePath, err := createOutFile(outDir, url)
-	defer outFile.Close()
+func (repo OfficialRepo) GetInfoToDownload(conf Conf) (res OfficialInfoResponse, url string, err error) {
+	bytes, err := repo.InfoRaw(conf)
 	if err != nil {
 		return
 	}
-	resp, err := http.Get(url)
+	res, err = repo.ParseInfoResponse(bytes)
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-	_, err = io.Copy(outFile, resp.Body)
+	if res.PkgBase == "" {
+		res.PkgBase = res.PkgName
+	}
+	project := PackagingProjectPath(res.PkgBase)
+	url = fmt.Sprintf("%s/%s/-/archive/%s/%s-%s.tar.gz",
+		repo.PackagingURL(conf, res.Repo), project, OfficialPackagingRef, project, OfficialPackagingRef)
+	return
+}
+
+func (repo OfficialRepo) Clone(conf Conf, repoName string, pkgBase string, destDir string) (err error) {
+	url := repo.PackagingURL(conf, repoName) + "/" + PackagingProjectPath(pkgBase) + ".git"
+	color.New(color.FgBlue).Add(color.Bold).Println("Cloning " + url + " ...")
+	err = runCommand("git", "clone", url, destDir)
 	return
 }
 
 func (repo OfficialRepo) Get(conf Conf) (newOutFilePath string, err error) {
-	info, isCommunity, url, err := repo.GetInfoToDownload(conf)
+	info, url, err := repo.GetInfoToDownload(conf)
 	if err != nil {
 		return
 	}
 
-	destDir := path.Join(conf.OutDir, info.PkgName)
+	destDir := path.Join(conf.OutDir, info.PkgBase)
 	_, err = os.Stat(destDir)
 	if err == nil {
 		err = errors.New(destDir + " already exists")
@@ -282,33 +375,15 @@ func (repo OfficialRepo) Get(conf Conf) (newOutFilePath string, err error) {
 	}
 	err = nil
 
-	tempDir, err := ioutil.TempDir("", "srchway-")
-	if err != nil {
-		return
-	}
-
-	color.New(color.FgBlue).Add(color.Bold).Println("Downloading " + url + " ...")
-	tarGzPath, err := repo.DownloadTarGz(conf, url, tempDir)
-	if err != nil {
-		return
-	}
-
-	color.New(color.FgBlue).Add(color.Bold).Println("Extracting " + tarGzPath + " ...")
-	newOutFilePath, err = ExtractAndRemoveTarGz(tarGzPath)
-	var packagesDir string
-	if isCommunity {
-		packagesDir = "community-packages"
-	} else {
-		packagesDir = "packages"
-	}
-
-	srcDir := path.Join(newOutFilePath, packagesDir, info.PkgName, "repos", info.Repo+"-x86_64")
-	color.New(color.FgBlue).Add(color.Bold).Println("Copying " + srcDir + " to " + destDir + " ...")
-	err = shutil.CopyTree(srcDir, destDir, nil)
-	if err != nil {
+	if conf.GitFlag {
+		err = repo.Clone(conf, info.Repo, info.PkgBase, destDir)
+		newOutFilePath = destDir
 		return
 	}
 
-	err = os.RemoveAll(tempDir)
+	// GitLab archives contain a single "<project>-<ref>-<commit>" directory
+	color.New(color.FgBlue).Add(color.Bold).Println("Downloading " + url + " to " + destDir + " ...")
+	err = DownloadAndExtract(conf, url, destDir, 1)
+	newOutFilePath = destDir
 	return
 }
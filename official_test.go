@@ -0,0 +1,149 @@
+package srchway
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// servePaths serves the bodies of paths (by request path) and records the requested paths.
+func servePaths(t *testing.T, paths map[string][]byte) (srv *httptest.Server, requested *[]string) {
+	requested = new([]string)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		*requested = append(*requested, req.URL.Path)
+		body, ok := paths[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return
+}
+
+func checkFile(t *testing.T, filePath string, want string) {
+	t.Helper()
+	b, err := os.ReadFile(filePath)
+	if err != nil || string(b) != want {
+		t.Errorf("%s = %q, %v, want %q", filePath, b, err, want)
+	}
+}
+
+func TestOfficialGet(t *testing.T) {
+	// the pkgbase differs from the pkgname and is not a valid GitLab project path
+	archivePath := "/packaging/libsigcplusplus/-/archive/main/libsigcplusplus-main.tar.gz"
+	// there is no x86_64 package, so Info falls back to "any"
+	srv, requested := servePaths(t, map[string][]byte{
+		"/packages/core/any/libsigc++-docs/json": []byte(`{"pkgname":"libsigc++-docs","pkgbase":"libsigc++",` +
+			`"repo":"core","arch":"any","pkgver":"2.12.1","pkgrel":"1","epoch":0}`),
+		archivePath: buildTarGz(t, tarEntry{typ: tar.TypeXGlobalHeader},
+			tarDir("libsigcplusplus-main-0123abcd/"),
+			tarFile("libsigcplusplus-main-0123abcd/PKGBUILD", "pkgbase=libsigc++"),
+			tarFile("libsigcplusplus-main-0123abcd/keys/pgp/key.asc", "key"),
+		),
+	})
+	outDir := t.TempDir()
+	conf := Conf{
+		OfficialURL:  srv.URL + "/packages",
+		PackagingURL: srv.URL + "/packaging",
+		OutDir:       outDir,
+		Args:         []string{"core/libsigc++-docs"},
+	}
+	destDir, err := OfficialRepo{}.Get(conf)
+	if err != nil {
+		t.Fatalf("Get() = %v (requested %q)", err, *requested)
+	}
+	if want := filepath.Join(outDir, "libsigc++"); destDir != want {
+		t.Errorf("Get() = %s, want %s", destDir, want)
+	}
+	if last := (*requested)[len(*requested)-1]; last != archivePath {
+		t.Errorf("downloaded %s, want %s", last, archivePath)
+	}
+	// the "<project>-<ref>-<commit>" directory is stripped
+	checkFile(t, filepath.Join(destDir, "PKGBUILD"), "pkgbase=libsigc++")
+	checkFile(t, filepath.Join(destDir, "keys", "pgp", "key.asc"), "key")
+
+	if _, err := (OfficialRepo{}).Get(conf); err == nil {
+		t.Error("Get() over an existing directory = nil error")
+	}
+}
+
+// serveSearchPages serves total search results in pages of pageSize and counts the requests.
+func serveSearchPages(t *testing.T, total int, pageSize int) (srv *httptest.Server, requests *int) {
+	requests = new(int)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		*requests++
+		page, err := strconv.Atoi(req.URL.Query().Get("page"))
+		if err != nil {
+			page = 1
+		}
+		res := OfficialSearchResponse{Version: 2, Limit: pageSize, Valid: true, Page: page}
+		res.NumPages = (total + pageSize - 1) / pageSize
+		for i := (page - 1) * pageSize; i < page*pageSize && i < total; i++ {
+			res.Results = append(res.Results, OfficialSearchResult{PkgName: fmt.Sprintf("pkg%02d", i), Repo: "extra"})
+		}
+		bytes, _ := json.Marshal(res)
+		w.Write(bytes)
+	}))
+	t.Cleanup(srv.Close)
+	return
+}
+
+func TestOfficialSearchPages(t *testing.T) {
+	tests := []struct {
+		desc         string
+		total, limit int
+		want         int
+		truncated    bool
+		requests     int
+	}{
+		{"below one page", 7, 2, 2, true, 1},
+		{"one page", 7, 3, 3, true, 1},
+		{"one page of one", 3, 3, 3, false, 1},
+		{"all results", 7, 7, 7, false, 3},
+		{"more than all", 7, 100, 7, false, 3},
+		{"across pages", 7, 5, 5, true, 2},
+		{"no results", 0, 3, 0, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			srv, requests := serveSearchPages(t, tt.total, 3)
+			conf := Conf{OfficialURL: srv.URL, Limit: tt.limit, Args: []string{"pkg"}}
+			pkgs, err := OfficialRepo{}.Search(conf)
+			var truncErr *TruncatedError
+			if tt.truncated {
+				if !errors.As(err, &truncErr) || truncErr.Limit != tt.limit {
+					t.Errorf("Search() error = %v, want a *TruncatedError with limit %d", err, tt.limit)
+				}
+			} else if err != nil {
+				t.Errorf("Search() error = %v", err)
+			}
+			if len(pkgs) != tt.want {
+				t.Errorf("Search() = %d packages, want %d", len(pkgs), tt.want)
+			}
+			for i, pkg := range pkgs {
+				if want := fmt.Sprintf("pkg%02d", i); pkg.Name != want {
+					t.Errorf("Search()[%d] = %s, want %s", i, pkg.Name, want)
+				}
+			}
+			if *requests != tt.requests {
+				t.Errorf("Search() made %d requests, want %d", *requests, tt.requests)
+			}
+		})
+	}
+
+	// SearchByName has no limit
+	srv, _ := serveSearchPages(t, 7, 3)
+	pkgs, err := OfficialRepo{}.SearchByName(Conf{OfficialURL: srv.URL}, "pkg")
+	if err != nil || len(pkgs) != 7 {
+		t.Errorf("SearchByName() = %d packages, %v, want 7", len(pkgs), err)
+	}
+}
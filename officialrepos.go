@@ -0,0 +1,132 @@
+package srchway
+
+import (
+	"errors"
+	"strings"
+)
+
+// OfficialRepoInfo describes a repository of the official web API.
+type OfficialRepoInfo struct {
+	// Name is the name used by pacman and in package URLs (e.g. "core-testing").
+	Name string
+	// APIName is the value of the repo parameter of the search API (e.g. "Core-Testing").
+	APIName string
+	// Aliases are former names which now refer to this repository.
+	Aliases []string
+	// PackagingURL is the base URL of the packaging repositories of its packages.
+	PackagingURL string
+	// Default repositories are searched unless --repo is given.
+	Default bool
+	// Testing and Multilib repositories are searched with --testing and --multilib.
+	Testing  bool
+	Multilib bool
+}
+
+// OfficialRepos lists the official repositories.
+var OfficialRepos = []OfficialRepoInfo{
+	{Name: "core", APIName: "Core", PackagingURL: OfficialPackagingURL, Default: true},
+	{Name: "extra", APIName: "Extra", Aliases: []string{"community"}, PackagingURL: OfficialPackagingURL, Default: true},
+	{Name: "core-testing", APIName: "Core-Testing", Aliases: []string{"testing"}, PackagingURL: OfficialPackagingURL, Testing: true},
+	{Name: "extra-testing", APIName: "Extra-Testing", Aliases: []string{"community-testing"}, PackagingURL: OfficialPackagingURL, Testing: true},
+	{Name: "multilib", APIName: "Multilib", PackagingURL: OfficialPackagingURL, Multilib: true},
+	{Name: "multilib-testing", APIName: "Multilib-Testing", PackagingURL: OfficialPackagingURL, Testing: true, Multilib: true},
+	{Name: "core-staging", APIName: "Core-Staging", PackagingURL: OfficialPackagingURL},
+	{Name: "extra-staging", APIName: "Extra-Staging", Aliases: []string{"staging", "community-staging"}, PackagingURL: OfficialPackagingURL},
+	{Name: "multilib-staging", APIName: "Multilib-Staging", PackagingURL: OfficialPackagingURL},
+	{Name: "gnome-unstable", APIName: "Gnome-Unstable", PackagingURL: OfficialPackagingURL},
+	{Name: "kde-unstable", APIName: "KDE-Unstable", PackagingURL: OfficialPackagingURL},
+}
+
+// LookupOfficialRepo finds an official repository by its name, API name or alias (case-insensitively).
+func LookupOfficialRepo(name string) (info OfficialRepoInfo, ok bool) {
+	for _, info = range OfficialRepos {
+		if strings.EqualFold(info.Name, name) || strings.EqualFold(info.APIName, name) {
+			return info, true
+		}
+		for _, alias := range info.Aliases {
+			if strings.EqualFold(alias, name) {
+				return info, true
+			}
+		}
+	}
+	return OfficialRepoInfo{}, false
+}
+
+// CanonicalRepoName returns the name of the official repository called name (e.g. "extra" for
+// "community"), or name itself if it is not an official repository.
+func CanonicalRepoName(name string) string {
+	if info, ok := LookupOfficialRepo(name); ok {
+		return info.Name
+	}
+	return name
+}
+
+// ParseRepoList parses a comma-separated list of repositories (as given to --repo). Official
+// repositories are canonicalised; other names are kept as they are, as they may be the names
+// of sync databases (see CheckRepoNames).
+func ParseRepoList(list string) (names []string, err error) {
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = CanonicalRepoName(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		err = errors.New("no repository specified")
+	}
+	return
+}
+
+// UsesSyncDBs reports whether the official packages are read from the sync (or files) databases
+// rather than from the official web API.
+func (conf Conf) UsesSyncDBs() bool {
+	switch conf.Operation {
+	case OperationTypeFiles:
+		return !conf.RemoteFlag
+	case OperationTypeReverseDeps:
+		return true
+	}
+	return conf.SyncDBFlag
+}
+
+// CheckRepoNames checks that conf.RepoNames are official repositories unless the sync
+// databases are used, where any database name is accepted.
+func (conf Conf) CheckRepoNames() (err error) {
+	if conf.UsesSyncDBs() {
+		return
+	}
+	for _, name := range conf.RepoNames {
+		if _, ok := LookupOfficialRepo(name); !ok {
+			err = errors.New("unknown repository: " + name + " (only sync databases may be other repositories)")
+			return
+		}
+	}
+	return
+}
+
+// officialRepos returns the repositories selected by conf.RepoNames,
+// or by the default, testing and multilib flags if it is empty.
+func (conf Conf) officialRepos() (repos []OfficialRepoInfo) {
+	if len(conf.RepoNames) != 0 {
+		for _, name := range conf.RepoNames {
+			if info, ok := LookupOfficialRepo(name); ok {
+				repos = append(repos, info)
+			}
+		}
+		return
+	}
+	for _, info := range OfficialRepos {
+		if (info.Testing && !conf.TestingFlag) || (info.Multilib && !conf.MultilibFlag) {
+			continue
+		}
+		if info.Default || info.Testing || info.Multilib {
+			repos = append(repos, info)
+		}
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package srchway
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Package is a backend-independent description of a package.
+type Package struct {
+	Repo           string    `json:"repo"`
+	Name           string    `json:"name"`
+	Base           string    `json:"base"`
+	Version        string    `json:"version"`
+	Epoch          int       `json:"epoch"`
+	Description    string    `json:"description"`
+	URL            string    `json:"url"`
+	Arch           string    `json:"arch,omitempty"`
+	Licenses       []string  `json:"licenses"`
+	Groups         []string  `json:"groups"`
+	Depends        []string  `json:"depends"`
+	MakeDepends    []string  `json:"makedepends"`
+	CheckDepends   []string  `json:"checkdepends"`
+	OptDepends     []string  `json:"optdepends"`
+	Provides       []string  `json:"provides"`
+	Conflicts      []string  `json:"conflicts"`
+	Replaces       []string  `json:"replaces"`
+	Keywords       []string  `json:"keywords,omitempty"`
+	Maintainers    []string  `json:"maintainers"`
+	Packager       string    `json:"packager,omitempty"`
+	FileName       string    `json:"filename,omitempty"`
+	CompressedSize int64     `json:"compressed_size,omitempty"`
+	InstalledSize  int64     `json:"installed_size,omitempty"`
+	BuildDate      time.Time `json:"build_date"`
+	FirstSubmitted time.Time `json:"first_submitted"`
+	LastModified   time.Time `json:"last_modified"`
+	FlagDate       time.Time `json:"flag_date"`
+	OutOfDate      bool      `json:"out_of_date"`
+	Votes          int       `json:"votes,omitempty"`
+	Popularity     float64   `json:"popularity,omitempty"`
+	SnapshotURL    string    `json:"snapshot_url,omitempty"`
+	Files          []string  `json:"files,omitempty"`
+	RequiredBy     []string  `json:"required_by,omitempty"`
+	OptionalFor    []string  `json:"optional_for,omitempty"`
+	Shadows        string    `json:"shadows,omitempty"`
+}
+
+// IsUser reports whether pkg comes from the AUR.
+func (pkg Package) IsUser() bool {
+	return pkg.Repo == UserRepoName
+}
+
+// FullName returns "repo/name".
+func (pkg Package) FullName() string {
+	return pkg.Repo + "/" + pkg.Name
+}
+
+// FormatVersion builds "[epoch:]pkgver-pkgrel".
+func FormatVersion(epoch int, pkgVer string, pkgRel string) (version string) {
+	version = pkgVer
+	if pkgRel != "" {
+		version += "-" + pkgRel
+	}
+	if epoch != 0 {
+		version = strconv.Itoa(epoch) + ":" + version
+	}
+	return
+}
+
+// ParseEpoch returns the epoch of a "[epoch:]pkgver-pkgrel" string (0 if absent).
+func ParseEpoch(version string) (epoch int) {
+	i := strings.Index(version, ":")
+	if i < 0 {
+		return
+	}
+	epoch, _ = strconv.Atoi(version[:i])
+	return
+}
+
+func parseTime(s string) (t time.Time) {
+	if s == "" {
+		return
+	}
+	t, _ = time.Parse(time.RFC3339, s)
+	return
+}
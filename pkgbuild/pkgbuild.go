@@ -0,0 +1,267 @@
+// Package pkgbuild extracts metadata from a PKGBUILD without executing it.
+//
+// Only top-level variable assignments and assignments at the top of package() functions are
+// evaluated. Parameter, brace and arithmetic expansion are supported; command substitutions
+// and any other statement are reported as Unresolved.
+package pkgbuild
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/taskie/srchway/srcinfo"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Variable is the value of a shell variable. Scalars have a single value and Array unset.
+type Variable struct {
+	Array  bool
+	Values []string
+}
+
+// String returns the first value (what "$var" expands to).
+func (v Variable) String() string {
+	if len(v.Values) == 0 {
+		return ""
+	}
+	return v.Values[0]
+}
+
+// Unresolved describes a part of the PKGBUILD which could not be evaluated statically.
+type Unresolved struct {
+	Pos    string
+	Name   string
+	Reason string
+}
+
+func (u Unresolved) String() string {
+	if u.Name == "" {
+		return u.Pos + ": " + u.Reason
+	}
+	return u.Pos + ": " + u.Name + ": " + u.Reason
+}
+
+// PKGBUILD is the statically evaluated content of a PKGBUILD.
+type PKGBUILD struct {
+	// Vars holds the global variables.
+	Vars map[string]Variable
+	// Functions lists the defined functions in order.
+	Functions []string
+	// Overrides maps a package name to the variables assigned in its package function.
+	Overrides map[string]map[string]Variable
+	// Unresolved lists what could not be evaluated.
+	Unresolved []Unresolved
+}
+
+// Parse reads and evaluates a PKGBUILD. Errors are returned only for syntax errors.
+func Parse(r io.Reader, name string) (p *PKGBUILD, err error) {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(r, name)
+	if err != nil {
+		return
+	}
+	p = &PKGBUILD{
+		Vars:      make(map[string]Variable),
+		Overrides: make(map[string]map[string]Variable),
+	}
+	var funcs []*syntax.FuncDecl
+	for _, stmt := range file.Stmts {
+		if fn, ok := stmt.Cmd.(*syntax.FuncDecl); ok {
+			p.Functions = append(p.Functions, fn.Name.Value)
+			funcs = append(funcs, fn)
+			continue
+		}
+		p.evalStmt(stmt, p.Vars, true)
+	}
+	// package functions see every global, wherever it is assigned
+	for _, fn := range funcs {
+		pkgName, ok := p.packageFunctionName(fn.Name.Value)
+		if !ok {
+			continue
+		}
+		vars := make(map[string]Variable)
+		if block, ok := fn.Body.Cmd.(*syntax.Block); ok {
+			for _, stmt := range block.Stmts {
+				p.evalStmt(stmt, vars, false)
+			}
+		}
+		p.Overrides[pkgName] = vars
+	}
+	return
+}
+
+// ParseFile reads and evaluates the PKGBUILD at filePath.
+func ParseFile(filePath string) (p *PKGBUILD, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	p, err = Parse(file, filePath)
+	return
+}
+
+func (p *PKGBUILD) packageFunctionName(funcName string) (pkgName string, ok bool) {
+	names := p.Vars["pkgname"].Values
+	switch {
+	case funcName == "package" && len(names) != 0:
+		return names[0], true
+	case strings.HasPrefix(funcName, "package_"):
+		return strings.TrimPrefix(funcName, "package_"), true
+	}
+	return
+}
+
+func (p *PKGBUILD) unresolved(node syntax.Node, name string, reason string) {
+	p.Unresolved = append(p.Unresolved, Unresolved{Pos: node.Pos().String(), Name: name, Reason: reason})
+}
+
+// evalStmt evaluates "a=b" and "a=(b c)" statements into vars. Other statements are reported
+// when report is set (function bodies contain build commands which are expected to be skipped).
+func (p *PKGBUILD) evalStmt(stmt *syntax.Stmt, vars map[string]Variable, report bool) {
+	call, ok := stmt.Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Args) != 0 || stmt.Negated || stmt.Background || len(stmt.Redirs) != 0 {
+		if report {
+			p.unresolved(stmt, "", "statement not evaluated")
+		}
+		return
+	}
+	for _, assign := range call.Assigns {
+		name := assign.Name.Value
+		v, err := p.evalAssign(assign, vars)
+		if err != nil {
+			p.unresolved(assign, name, err.Error())
+			continue
+		}
+		vars[name] = v
+	}
+}
+
+func (p *PKGBUILD) evalAssign(assign *syntax.Assign, vars map[string]Variable) (v Variable, err error) {
+	if assign.Index != nil {
+		err = fmt.Errorf("indexed assignment")
+		return
+	}
+	cfg := &expand.Config{Env: environ{p.Vars, vars}, NoUnset: true}
+	if assign.Array != nil {
+		v.Array = true
+		for _, elem := range assign.Array.Elems {
+			if elem.Index != nil {
+				err = fmt.Errorf("indexed array element")
+				return
+			}
+			var fields []string
+			fields, err = expand.Fields(cfg, elem.Value)
+			if err != nil {
+				return
+			}
+			v.Values = append(v.Values, fields...)
+		}
+	} else if assign.Value != nil {
+		var s string
+		s, err = expand.Literal(cfg, assign.Value)
+		if err != nil {
+			return
+		}
+		v.Values = []string{s}
+	} else {
+		v.Values = []string{""}
+	}
+	if assign.Append {
+		prev := environ{p.Vars, vars}.lookup(assign.Name.Value)
+		v.Array = v.Array || prev.Array
+		v.Values = append(append([]string{}, prev.Values...), v.Values...)
+	}
+	return
+}
+
+// environ exposes the evaluated variables to the expander; locals shadow globals.
+type environ struct {
+	globals map[string]Variable
+	locals  map[string]Variable
+}
+
+func (env environ) lookup(name string) Variable {
+	if v, ok := env.locals[name]; ok {
+		return v
+	}
+	return env.globals[name]
+}
+
+func (env environ) Get(name string) expand.Variable {
+	v, ok := env.locals[name]
+	if !ok {
+		v, ok = env.globals[name]
+	}
+	// Set must be given: since mvdan.cc/sh v3.11, IsSet() only checks it
+	switch {
+	case !ok:
+		return expand.Variable{}
+	case v.Array:
+		return expand.Variable{Set: true, Kind: expand.Indexed, List: v.Values}
+	default:
+		return expand.Variable{Set: true, Kind: expand.String, Str: v.String()}
+	}
+}
+
+func (env environ) Each(fn func(name string, vr expand.Variable) bool) {
+	for _, vars := range []map[string]Variable{env.globals, env.locals} {
+		for name := range vars {
+			if !fn(name, env.Get(name)) {
+				return
+			}
+		}
+	}
+}
+
+// PackageBase returns pkgbase, or the first pkgname.
+func (p *PKGBUILD) PackageBase() string {
+	if base := p.Vars["pkgbase"].String(); base != "" {
+		return base
+	}
+	return p.Vars["pkgname"].String()
+}
+
+func addFields(section *srcinfo.Section, vars map[string]Variable, accept func(key string) bool) {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key, arch := srcinfo.SplitKey(name)
+		if !accept(key) || (arch != "" && !srcinfo.IsArchSpecific(key)) {
+			continue
+		}
+		values := vars[name].Values
+		if len(values) == 0 {
+			// an empty override ("depends=()") is kept as "depends = "
+			values = []string{""}
+		}
+		for _, value := range values {
+			section.Add(key, arch, value)
+		}
+	}
+}
+
+// SrcInfo converts the evaluated variables to the .SRCINFO model.
+func (p *PKGBUILD) SrcInfo() (info *srcinfo.SrcInfo) {
+	info = &srcinfo.SrcInfo{Base: srcinfo.Section{Name: p.PackageBase()}}
+	globals := make(map[string]Variable)
+	for name, v := range p.Vars {
+		if len(v.Values) != 0 {
+			globals[name] = v
+		}
+	}
+	addFields(&info.Base, globals, srcinfo.IsBaseKey)
+	for _, name := range p.Vars["pkgname"].Values {
+		section := srcinfo.Section{Name: name}
+		addFields(&section, p.Overrides[name], srcinfo.IsPackageKey)
+		info.Packages = append(info.Packages, section)
+	}
+	info.Sort()
+	return
+}
@@ -0,0 +1,129 @@
+package pkgbuild
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const splitPKGBUILD = `# Maintainer: Someone <someone@example.com>
+_name=Foo-Bar
+pkgbase=foo-bar
+pkgname=(foo-bar python-foo-bar)
+pkgver=1.2.3
+pkgrel=2
+pkgdesc="A ${_name} library"
+arch=(x86_64 aarch64)
+url="https://example.com/${_name,,}"
+license=('MIT')
+depends=(glibc)
+makedepends=(cmake python-{build,installer,wheel})
+source=("https://example.com/${_name}-${pkgver}.tar.gz"
+        "${_name,,}-fix.patch")
+source+=("extra-$pkgver.patch")
+sha256sums=('SKIP' 'SKIP' 'SKIP')
+depends_x86_64=(lib32-glibc)
+_so=libfoo.so.${pkgver%%.*}
+
+build() {
+  cmake -B build -S "${_name}-${pkgver}"
+  cmake --build build
+}
+
+package_foo-bar() {
+  provides=("$_so")
+  depends+=(zlib)
+  install -Dm755 build/foo "$pkgdir/usr/bin/foo"
+}
+
+package_python-foo-bar() {
+  pkgdesc="Python bindings for ${_name}"
+  depends=(foo-bar="$pkgver" python)
+  arch=(any)
+}
+`
+
+func TestParseSplitPackage(t *testing.T) {
+	p, err := Parse(strings.NewReader(splitPKGBUILD), "PKGBUILD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Unresolved) != 0 {
+		t.Errorf("Unresolved = %v", p.Unresolved)
+	}
+	globals := []struct {
+		name string
+		want []string
+	}{
+		{"pkgname", []string{"foo-bar", "python-foo-bar"}},
+		{"pkgdesc", []string{"A Foo-Bar library"}},
+		{"url", []string{"https://example.com/foo-bar"}},
+		{"makedepends", []string{"cmake", "python-build", "python-installer", "python-wheel"}},
+		{"source", []string{"https://example.com/Foo-Bar-1.2.3.tar.gz", "foo-bar-fix.patch", "extra-1.2.3.patch"}},
+		{"depends", []string{"glibc"}},
+		{"depends_x86_64", []string{"lib32-glibc"}},
+		{"_so", []string{"libfoo.so.1"}},
+	}
+	for _, tt := range globals {
+		if got := p.Vars[tt.name].Values; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	overrides := []struct {
+		pkg  string
+		name string
+		want []string
+	}{
+		{"foo-bar", "provides", []string{"libfoo.so.1"}},
+		{"foo-bar", "depends", []string{"glibc", "zlib"}},
+		{"python-foo-bar", "pkgdesc", []string{"Python bindings for Foo-Bar"}},
+		{"python-foo-bar", "depends", []string{"foo-bar=1.2.3", "python"}},
+		{"python-foo-bar", "arch", []string{"any"}},
+	}
+	for _, tt := range overrides {
+		if got := p.Overrides[tt.pkg][tt.name].Values; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %s = %q, want %q", tt.pkg, tt.name, got, tt.want)
+		}
+	}
+	if p.PackageBase() != "foo-bar" {
+		t.Errorf("PackageBase() = %q", p.PackageBase())
+	}
+}
+
+func TestParseUnresolved(t *testing.T) {
+	input := "pkgname=foo\npkgver=$(date +%Y)\ndepends=($_undefined)\necho hi\n"
+	p, err := Parse(strings.NewReader(input), "PKGBUILD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, u := range p.Unresolved {
+		names[u.Name] = true
+	}
+	if !names["pkgver"] || !names["depends"] || !names[""] || len(p.Unresolved) != 3 {
+		t.Errorf("Unresolved = %v, want pkgver, depends and the echo statement", p.Unresolved)
+	}
+	if _, ok := p.Vars["pkgver"]; ok {
+		t.Error("pkgver should not be set")
+	}
+}
+
+func TestSrcInfo(t *testing.T) {
+	p, err := Parse(strings.NewReader(splitPKGBUILD), "PKGBUILD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := p.SrcInfo()
+	if info.Base.Name != "foo-bar" || len(info.Packages) != 2 {
+		t.Fatalf("SrcInfo() = %+v", info)
+	}
+	if got := info.Base.Values("depends", "x86_64"); !reflect.DeepEqual(got, []string{"lib32-glibc"}) {
+		t.Errorf("depends_x86_64 = %q", got)
+	}
+	if got := info.Packages[1].Values("depends", ""); !reflect.DeepEqual(got, []string{"foo-bar=1.2.3", "python"}) {
+		t.Errorf("python-foo-bar depends = %q", got)
+	}
+	if info.Packages[0].Has("pkgdesc", "") {
+		t.Error("foo-bar should not override pkgdesc")
+	}
+}
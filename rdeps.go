@@ -0,0 +1,149 @@
+package srchway
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ReverseDeps lists the packages depending on a package, by kind of dependency.
+type ReverseDeps struct {
+	Name         string    `json:"name"`
+	Depends      []Package `json:"depends"`
+	MakeDepends  []Package `json:"makedepends"`
+	CheckDepends []Package `json:"checkdepends"`
+	OptDepends   []Package `json:"optdepends"`
+	// target is the package called Name if known: dependencies on its provides count too
+	target *Package
+}
+
+// add files pkg under every kind of dependency it has on rdeps.Name. If the target package
+// is known, a dependency counts if the target satisfies it (like _alpm_depcmp), by name or
+// by provides and with its version constraint.
+func (rdeps *ReverseDeps) add(pkg Package) {
+	dependsOn := func(deps []string) bool {
+		for _, depString := range deps {
+			dep := ParseDependency(depString)
+			if rdeps.target != nil && dep.SatisfiedBy(*rdeps.target) || rdeps.target == nil && dep.Name == rdeps.Name {
+				return true
+			}
+		}
+		return false
+	}
+	if dependsOn(pkg.Depends) {
+		rdeps.Depends = append(rdeps.Depends, pkg)
+	}
+	if dependsOn(pkg.MakeDepends) {
+		rdeps.MakeDepends = append(rdeps.MakeDepends, pkg)
+	}
+	if dependsOn(pkg.CheckDepends) {
+		rdeps.CheckDepends = append(rdeps.CheckDepends, pkg)
+	}
+	if dependsOn(pkg.OptDepends) {
+		rdeps.OptDepends = append(rdeps.OptDepends, pkg)
+	}
+}
+
+// userReverseDepsFields lists the AUR search fields queried by ReverseDependencies.
+var userReverseDepsFields = []string{"depends", "makedepends", "checkdepends", "optdepends"}
+
+// ReverseDependencies finds the packages depending on name: in the sync databases (the official
+// "required by" data, unless conf.OfficialFlag is unset) and in the AUR (if conf.AurFlag is set).
+// errs holds the errors of the sources which could not be searched.
+func ReverseDependencies(conf Conf, name string) (rdeps ReverseDeps, errs []error) {
+	rdeps = ReverseDeps{Name: name, Depends: []Package{}, MakeDepends: []Package{}, CheckDepends: []Package{}, OptDepends: []Package{}}
+	if conf.OfficialFlag {
+		dbs, err := LoadSyncDBs(conf)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("official: %w", err))
+		}
+		if pkg, ok := findInSyncDBs(dbs, name); ok {
+			rdeps.target = &pkg
+		}
+		for _, db := range dbs {
+			for _, pkg := range db.Packages {
+				rdeps.add(pkg)
+			}
+		}
+	}
+	if conf.AurFlag {
+		// search results lack the dependency fields, so fetch the full info of every match
+		var names []string
+		seen := make(map[string]bool)
+		for _, by := range userReverseDepsFields {
+			pkgs, err := UserRepo{}.searchBy(conf, by, name)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", UserRepoName, err))
+				continue
+			}
+			for _, pkg := range pkgs {
+				if !seen[pkg.Name] {
+					seen[pkg.Name] = true
+					names = append(names, pkg.Name)
+				}
+			}
+		}
+		sort.Strings(names)
+		if len(names) != 0 {
+			pkgs, err := UserRepo{}.MultiInfo(conf, names)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", UserRepoName, err))
+			}
+			sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+			for _, pkg := range pkgs {
+				rdeps.add(pkg)
+			}
+		}
+	}
+	return
+}
+
+func findInSyncDBs(dbs []SyncDB, name string) (pkg Package, ok bool) {
+	for _, db := range dbs {
+		for _, p := range db.Packages {
+			if p.Name == name {
+				return p, true
+			}
+		}
+	}
+	return
+}
+
+// SetRequiredBy sets the RequiredBy and OptionalFor of the packages of pkgs which are not from
+// the AUR (like pacman -Si), reading the sync databases once. Nothing is set if there are none.
+func SetRequiredBy(conf Conf, pkgs []Package) {
+	var dbs []SyncDB
+	loaded := false
+	for i := range pkgs {
+		if pkgs[i].Repo == UserRepoName {
+			continue
+		}
+		if !loaded {
+			loaded = true
+			conf.RepoNames = nil
+			dbs, _ = LoadSyncDBs(conf)
+		}
+		if len(dbs) == 0 {
+			return
+		}
+		setRequiredBy(dbs, &pkgs[i])
+	}
+}
+
+// setRequiredBy sets pkg.RequiredBy and pkg.OptionalFor from the sync databases.
+func setRequiredBy(dbs []SyncDB, pkg *Package) {
+	target := *pkg
+	rdeps := ReverseDeps{Name: pkg.Name, target: &target}
+	for _, db := range dbs {
+		for _, p := range db.Packages {
+			rdeps.add(p)
+		}
+	}
+	pkg.RequiredBy = make([]string, 0, len(rdeps.Depends))
+	for _, p := range rdeps.Depends {
+		pkg.RequiredBy = append(pkg.RequiredBy, p.Name)
+	}
+	pkg.OptionalFor = make([]string, 0, len(rdeps.OptDepends))
+	for _, p := range rdeps.OptDepends {
+		pkg.OptionalFor = append(pkg.OptionalFor, p.Name)
+	}
+}
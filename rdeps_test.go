@@ -0,0 +1,56 @@
+package srchway
+
+import (
+	"reflect"
+	"testing"
+)
+
+func packageNames(pkgs []Package) (names []string) {
+	names = []string{}
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name)
+	}
+	return
+}
+
+func TestSetRequiredBy(t *testing.T) {
+	dbPath := t.TempDir()
+	writeSyncDB(t, dbPath, "core",
+		map[string][]string{"NAME": {"bash"}, "VERSION": {"5.2.026-2"}, "PROVIDES": {"sh"}},
+		map[string][]string{"NAME": {"autoconf"}, "VERSION": {"2.72-1"}, "DEPENDS": {"sh", "perl"}},
+		map[string][]string{"NAME": {"bash-completion"}, "VERSION": {"2.11-3"}, "DEPENDS": {"bash"}},
+		map[string][]string{"NAME": {"old-script"}, "VERSION": {"1-1"}, "DEPENDS": {"bash<5"}},
+		// an unversioned provide does not satisfy a versioned dependency
+		map[string][]string{"NAME": {"picky"}, "VERSION": {"1-1"}, "DEPENDS": {"sh>=1"}},
+	)
+	writeSyncDB(t, dbPath, "extra",
+		map[string][]string{"NAME": {"git"}, "VERSION": {"2.43.0-1"}, "DEPENDS": {"perl"}, "OPTDEPENDS": {"bash: for git-completion"}},
+		map[string][]string{"NAME": {"dash"}, "VERSION": {"0.5.12-1"}, "OPTDEPENDS": {"sh: nothing"}},
+	)
+	conf := Conf{DBPath: dbPath}
+	pkgs := []Package{
+		{Repo: "core", Name: "bash", Version: "5.2.026-2", Provides: []string{"sh"}},
+		{Repo: UserRepoName, Name: "yay", Version: "12.3.0-1"},
+	}
+	SetRequiredBy(conf, pkgs)
+	if want := []string{"autoconf", "bash-completion"}; !reflect.DeepEqual(pkgs[0].RequiredBy, want) {
+		t.Errorf("RequiredBy = %q, want %q", pkgs[0].RequiredBy, want)
+	}
+	if want := []string{"dash", "git"}; !reflect.DeepEqual(pkgs[0].OptionalFor, want) {
+		t.Errorf("OptionalFor = %q, want %q", pkgs[0].OptionalFor, want)
+	}
+	if pkgs[1].RequiredBy != nil {
+		t.Errorf("AUR package got RequiredBy = %q", pkgs[1].RequiredBy)
+	}
+
+	rdeps, errs := ReverseDependencies(Conf{DBPath: dbPath, OfficialFlag: true}, "bash")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if want := []string{"autoconf", "bash-completion"}; !reflect.DeepEqual(packageNames(rdeps.Depends), want) {
+		t.Errorf("Depends = %q, want %q", packageNames(rdeps.Depends), want)
+	}
+	if want := []string{"dash", "git"}; !reflect.DeepEqual(packageNames(rdeps.OptDepends), want) {
+		t.Errorf("OptDepends = %q, want %q", packageNames(rdeps.OptDepends), want)
+	}
+}
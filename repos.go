@@ -1,9 +1,24 @@
 package srchway
 
 type Repo interface {
-	Search(conf Conf) (bytes []byte, err error)
-	Info(conf Conf) (bytes []byte, err error)
+	Search(conf Conf) (pkgs []Package, err error)
+	Info(conf Conf) (pkg Package, err error)
 	Get(conf Conf) (newOutFilePath string, err error)
-	PrintSearchResponse(conf Conf) (err error)
-	PrintInfoResponse(conf Conf) (err error)
+}
+
+// SearchFields lists the values accepted by Conf.SearchBy (--by).
+// The official repositories support name, name-desc and desc; the AUR supports all but desc.
+var SearchFields = []string{
+	"name", "name-desc", "desc", "maintainer", "depends", "makedepends", "optdepends",
+	"checkdepends", "provides", "conflicts", "replaces", "keywords", "groups", "submitter", "comaintainers",
+}
+
+// IsSearchField reports whether by is one of SearchFields.
+func IsSearchField(by string) bool {
+	for _, field := range SearchFields {
+		if field == by {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,292 @@
+package srchway
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// BuildPlan is the result of resolving the dependencies of AUR packages.
+type BuildPlan struct {
+	// Order lists the AUR packages to build, dependencies first (one entry per pkgbase).
+	Order []Package
+	// Repo lists the packages which satisfy dependencies from the official repositories.
+	Repo []Package
+	// Missing lists the dependencies found nowhere.
+	Missing []string
+	// Unverified lists the dependencies found nowhere by name when there are no sync databases:
+	// official packages may provide them, so AUR providers are not used.
+	Unverified []string
+}
+
+// Resolver resolves depends, makedepends and checkdepends recursively across the
+// official repositories and the AUR.
+type Resolver struct {
+	Conf     Conf
+	official OfficialRepo
+	user     UserRepo
+	userPkgs []Package
+	repoPkgs []Package
+	missing  []string
+	// unverified lists the dependencies which official packages may provide
+	unverified []string
+	// syncDBs are loaded on first use (syncDBsLoaded) to check the provides of official packages
+	syncDBs       []SyncDB
+	syncDBsLoaded bool
+	// edges maps an AUR pkgbase to the AUR pkgbases it depends on
+	edges map[string]map[string]bool
+}
+
+func NewResolver(conf Conf) *Resolver {
+	return &Resolver{
+		Conf:  conf,
+		edges: make(map[string]map[string]bool),
+	}
+}
+
+func findSatisfier(pkgs []Package, dep Dependency) (pkg Package, ok bool) {
+	for _, p := range pkgs {
+		if dep.SatisfiedBy(p) {
+			return p, true
+		}
+	}
+	return
+}
+
+// loadSyncDBs returns the sync databases, or nil if there are none.
+func (r *Resolver) loadSyncDBs() []SyncDB {
+	if !r.syncDBsLoaded {
+		r.syncDBsLoaded = true
+		r.syncDBs, _ = LoadSyncDBs(r.Conf)
+	}
+	return r.syncDBs
+}
+
+// canCheckProvides reports whether the provides of official packages are known.
+func (r *Resolver) canCheckProvides() bool {
+	return len(r.loadSyncDBs()) != 0
+}
+
+// lookupOfficial finds a package satisfying dep in the sync databases like pacman (a package
+// named dep.Name first, then one providing it), or by name only with the official web API
+// if there are no sync databases.
+func (r *Resolver) lookupOfficial(dep Dependency) (pkg Package, ok bool, err error) {
+	if dbs := r.loadSyncDBs(); len(dbs) != 0 {
+		for _, db := range dbs {
+			for _, p := range db.Packages {
+				if p.Name == dep.Name && dep.SatisfiedByVersion(p.Version) {
+					return p, true, nil
+				}
+			}
+		}
+		for _, db := range dbs {
+			if pkg, ok = findSatisfier(db.Packages, dep); ok {
+				return
+			}
+		}
+		return
+	}
+	pkgs, err := r.official.SearchByName(r.Conf, dep.Name)
+	if err != nil {
+		return
+	}
+	pkg, ok = findSatisfier(pkgs, dep)
+	return
+}
+
+// lookupUser finds the AUR package named dep.Name or, if providers is set, the most voted
+// AUR package providing it. Errors other than "not found" (e.g. an AUR outage) are returned.
+func (r *Resolver) lookupUser(dep Dependency, providers bool) (pkg Package, ok bool, err error) {
+	conf := r.Conf
+	conf.Args = []string{dep.Name}
+	pkg, err = r.user.Info(conf)
+	if err != nil && !IsNotFound(err) {
+		return
+	}
+	if err == nil && dep.SatisfiedBy(pkg) {
+		return pkg, true, nil
+	}
+	pkg, err = Package{}, nil
+	if !providers {
+		return
+	}
+	// fall back to the packages providing the name, most voted first
+	pkgs, err := r.user.searchBy(conf, "provides", dep.Name)
+	if err != nil {
+		return
+	}
+	sort.SliceStable(pkgs, func(i, j int) bool { return pkgs[i].Votes > pkgs[j].Votes })
+	for _, p := range pkgs {
+		// search results lack provides, so fetch the full info
+		conf.Args = []string{p.Name}
+		p, err = r.user.Info(conf)
+		if IsNotFound(err) {
+			// deleted since the search
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if dep.SatisfiedBy(p) {
+			return p, true, nil
+		}
+	}
+	return
+}
+
+// resolve returns the AUR pkgbase satisfying dep ("" if it comes from elsewhere).
+func (r *Resolver) resolve(depString string) (pkgBase string, err error) {
+	dep := ParseDependency(depString)
+	if pkg, ok := findSatisfier(r.userPkgs, dep); ok {
+		return pkg.Base, nil
+	}
+	if _, ok := findSatisfier(r.repoPkgs, dep); ok {
+		return
+	}
+	pkg, ok, err := r.lookupOfficial(dep)
+	if err != nil {
+		return
+	}
+	if ok {
+		r.repoPkgs = append(r.repoPkgs, pkg)
+		return
+	}
+	// an AUR provider must not replace an official package which may provide dep
+	checked := r.canCheckProvides()
+	pkg, ok, err = r.lookupUser(dep, checked)
+	if err != nil {
+		return
+	}
+	if !ok {
+		if checked {
+			r.missing = append(r.missing, depString)
+		} else {
+			r.unverified = append(r.unverified, depString)
+		}
+		return
+	}
+	err = r.add(pkg)
+	pkgBase = pkg.Base
+	return
+}
+
+func (r *Resolver) add(pkg Package) (err error) {
+	r.userPkgs = append(r.userPkgs, pkg)
+	if r.edges[pkg.Base] == nil {
+		r.edges[pkg.Base] = make(map[string]bool)
+	}
+	deps := append(append(append([]string{}, pkg.Depends...), pkg.MakeDepends...), pkg.CheckDepends...)
+	for _, depString := range deps {
+		var depBase string
+		depBase, err = r.resolve(depString)
+		if err != nil {
+			return
+		}
+		if depBase != "" && depBase != pkg.Base {
+			r.edges[pkg.Base][depBase] = true
+		}
+	}
+	return
+}
+
+// Resolve resolves the AUR packages called names and all their dependencies.
+func (r *Resolver) Resolve(names []string) (plan BuildPlan, err error) {
+	for _, name := range names {
+		conf := r.Conf
+		conf.Args = []string{name}
+		var pkg Package
+		pkg, err = r.user.Info(conf)
+		if err != nil {
+			err = errors.New(name + ": " + err.Error())
+			return
+		}
+		if _, ok := findSatisfier(r.userPkgs, Dependency{Name: pkg.Name}); ok {
+			continue
+		}
+		err = r.add(pkg)
+		if err != nil {
+			return
+		}
+	}
+	order, err := r.buildOrder()
+	if err != nil {
+		return
+	}
+	for _, base := range order {
+		for _, pkg := range r.userPkgs {
+			if pkg.Base == base {
+				plan.Order = append(plan.Order, pkg)
+				break
+			}
+		}
+	}
+	plan.Repo = r.repoPkgs
+	plan.Missing = r.missing
+	plan.Unverified = r.unverified
+	return
+}
+
+// CycleError reports a dependency cycle between AUR pkgbases.
+type CycleError struct {
+	Cycle []string
+}
+
+func (e *CycleError) Error() string {
+	return "dependency cycle: " + strings.Join(e.Cycle, " -> ")
+}
+
+// buildOrder sorts the pkgbases topologically (dependencies first).
+func (r *Resolver) buildOrder() (order []string, err error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var stack []string
+	var visit func(base string) error
+	visit = func(base string) error {
+		switch state[base] {
+		case visiting:
+			for i, b := range stack {
+				if b == base {
+					return &CycleError{Cycle: append(append([]string{}, stack[i:]...), base)}
+				}
+			}
+		case visited:
+			return nil
+		}
+		state[base] = visiting
+		stack = append(stack, base)
+		for _, dep := range sortedKeys(r.edges[base]) {
+			if e := visit(dep); e != nil {
+				return e
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[base] = visited
+		order = append(order, base)
+		return nil
+	}
+	bases := make([]string, 0, len(r.edges))
+	for base := range r.edges {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+	for _, base := range bases {
+		err = visit(base)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func sortedKeys(m map[string]bool) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
@@ -0,0 +1,91 @@
+package srchway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLookupOfficialProvides(t *testing.T) {
+	dbPath := t.TempDir()
+	writeSyncDB(t, dbPath, "core",
+		map[string][]string{"NAME": {"bash"}, "VERSION": {"5.2.026-2"}, "PROVIDES": {"sh"}},
+		map[string][]string{"NAME": {"readline"}, "VERSION": {"8.2.010-1"}, "PROVIDES": {"libreadline.so=8-64", "libhistory.so=8-64"}},
+		map[string][]string{"NAME": {"sh"}, "VERSION": {"1-1"}},
+	)
+	writeSyncDB(t, dbPath, "extra",
+		map[string][]string{"NAME": {"jre-openjdk"}, "VERSION": {"21.0.2.u13-1"}, "PROVIDES": {"java-runtime=21", "java-runtime-openjdk=21"}},
+	)
+	r := NewResolver(Conf{DBPath: dbPath})
+	tests := []struct {
+		dep  string
+		want string
+	}{
+		{"sh", "sh"},
+		{"sh>=2", ""},
+		{"libreadline.so=8-64", "readline"},
+		{"libreadline.so=7-64", ""},
+		{"java-runtime>=17", "jre-openjdk"},
+		{"java-runtime<17", ""},
+		{"nonexistent", ""},
+	}
+	for _, tt := range tests {
+		pkg, ok, err := r.lookupOfficial(ParseDependency(tt.dep))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pkg.Name; got != tt.want || ok != (tt.want != "") {
+			t.Errorf("lookupOfficial(%q) = %q, %v, want %q", tt.dep, got, ok, tt.want)
+		}
+	}
+	if !r.canCheckProvides() {
+		t.Error("canCheckProvides() = false with sync databases")
+	}
+	if NewResolver(Conf{DBPath: t.TempDir()}).canCheckProvides() {
+		t.Error("canCheckProvides() = true without sync databases")
+	}
+}
+
+func TestLookupUserErrors(t *testing.T) {
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/packages/") {
+			// the official repositories work, but have no such package
+			w.Write([]byte(`{"version":2,"limit":250,"valid":true,"results":[],"num_pages":1,"page":1}`))
+			return
+		}
+		if status != http.StatusOK {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		w.Write([]byte(`{"version":5,"type":"` + req.URL.Query().Get("type") + `","resultcount":0,"results":[]}`))
+	}))
+	defer srv.Close()
+	dbPath := t.TempDir()
+	writeSyncDB(t, dbPath, "core", map[string][]string{"NAME": {"bash"}, "VERSION": {"5.2.026-2"}})
+	conf := Conf{DBPath: dbPath, OfficialURL: srv.URL + "/packages", UserURL: srv.URL, AurFlag: true}
+
+	// an AUR outage is an error, not a missing or unverified dependency, whether
+	// providers are searched (with sync databases) or not
+	for _, dbPath := range []string{dbPath, t.TempDir()} {
+		conf := conf
+		conf.DBPath = dbPath
+		r := NewResolver(conf)
+		if _, err := r.resolve("libfoo"); err == nil {
+			t.Errorf("resolve() with an AUR returning 500 = nil error, missing %q, unverified %q", r.missing, r.unverified)
+		}
+		if _, err := BuildGraph(conf, []string{"libfoo"}, 0); err == nil {
+			t.Error("BuildGraph() with an AUR returning 500 = nil error")
+		}
+	}
+
+	status = http.StatusOK
+	r := NewResolver(conf)
+	if _, err := r.resolve("libfoo"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(r.missing, ",") != "libfoo" {
+		t.Errorf("missing = %q, want [libfoo]", r.missing)
+	}
+}
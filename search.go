@@ -0,0 +1,107 @@
+package srchway
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RepoName returns a short name of repo for messages.
+func RepoName(repo Repo) string {
+	switch repo.(type) {
+	case OfficialRepo:
+		return "official"
+	case UserRepo:
+		return UserRepoName
+	case SyncDBRepo:
+		return "sync"
+	}
+	return "unknown"
+}
+
+// DefaultSearchTimeout is the deadline of SearchAll if conf.Timeout is not set.
+var DefaultSearchTimeout = 30 * time.Second
+
+// SearchAll searches every repository of conf concurrently and merges the results with MergePackages.
+// All the requests share a deadline of conf.Timeout (or DefaultSearchTimeout), so that a
+// backend which does not respond cannot block the search.
+// errs holds one error per failed repository; pkgs holds the results of the others
+// (and the partial results of a repository which failed with a *TruncatedError).
+func SearchAll(conf Conf) (pkgs []Package, errs []error) {
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSearchTimeout
+	}
+	ctx, cancel := context.WithTimeout(conf.context(), timeout)
+	defer cancel()
+	conf.Context = ctx
+
+	repos := conf.Repos()
+	results := make([][]Package, len(repos))
+	repoErrs := make([]error, len(repos))
+	var wg sync.WaitGroup
+	for i, repo := range repos {
+		wg.Add(1)
+		go func(i int, repo Repo) {
+			defer wg.Done()
+			results[i], repoErrs[i] = repo.Search(conf)
+		}(i, repo)
+	}
+	wg.Wait()
+
+	for i, err := range repoErrs {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", RepoName(repos[i]), err))
+		}
+	}
+	pkgs = MergePackages(conf.Args, results...)
+	return
+}
+
+// MergePackages concatenates lists of packages, drops duplicates and ranks them:
+// official packages first, then exact matches of a query word, then by votes and popularity.
+// AUR packages named like an official one are marked with Shadows.
+func MergePackages(query []string, lists ...[]Package) (pkgs []Package) {
+	seen := make(map[string]bool)
+	official := make(map[string]string)
+	for _, list := range lists {
+		for _, pkg := range list {
+			if seen[pkg.FullName()] {
+				continue
+			}
+			seen[pkg.FullName()] = true
+			pkgs = append(pkgs, pkg)
+			if !pkg.IsUser() {
+				if _, ok := official[pkg.Name]; !ok {
+					official[pkg.Name] = pkg.FullName()
+				}
+			}
+		}
+	}
+	for i := range pkgs {
+		if pkgs[i].IsUser() {
+			pkgs[i].Shadows = official[pkgs[i].Name]
+		}
+	}
+
+	exact := make(map[string]bool)
+	for _, word := range query {
+		exact[word] = true
+	}
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		a, b := pkgs[i], pkgs[j]
+		if a.IsUser() != b.IsUser() {
+			return !a.IsUser()
+		}
+		if exact[a.Name] != exact[b.Name] {
+			return exact[a.Name]
+		}
+		if a.Votes != b.Votes {
+			return a.Votes > b.Votes
+		}
+		return a.Popularity > b.Popularity
+	})
+	return
+}
@@ -0,0 +1,45 @@
+package srchway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSearchAllDefaultTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { DefaultSearchTimeout = timeout }(DefaultSearchTimeout)
+	DefaultSearchTimeout = 100 * time.Millisecond
+	// a backend which does not respond until the test ends
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer srv.Close()
+	defer close(stop)
+	conf := Conf{OfficialFlag: true, AurFlag: true, OfficialURL: srv.URL, UserURL: srv.URL, Args: []string{"foo"}}
+
+	done := make(chan []error)
+	go func() {
+		_, errs := SearchAll(conf)
+		done <- errs
+	}()
+	select {
+	case errs := <-done:
+		if len(errs) != 2 {
+			t.Fatalf("SearchAll() = %d errors, want 2", len(errs))
+		}
+		for _, err := range errs {
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("SearchAll() error = %v, want the deadline", err)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SearchAll() did not return")
+	}
+}
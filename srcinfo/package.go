@@ -0,0 +1,140 @@
+package srcinfo
+
+import "errors"
+
+// Package is the metadata of one package for one architecture: the pkgname section merged
+// over the pkgbase section, with the architecture-specific values appended.
+type Package struct {
+	Base         string
+	Name         string
+	Version      string
+	Release      string
+	Epoch        string
+	Desc         string
+	URL          string
+	Install      string
+	Changelog    string
+	Arch         []string
+	Groups       []string
+	License      []string
+	Backup       []string
+	Options      []string
+	NoExtract    []string
+	ValidPGPKeys []string
+	Source       []string
+	Depends      []string
+	MakeDepends  []string
+	CheckDepends []string
+	OptDepends   []string
+	Provides     []string
+	Conflicts    []string
+	Replaces     []string
+	// Sums maps an algorithm (e.g. "sha256") to the checksums of Source.
+	Sums map[string][]string
+}
+
+// FullVersion returns "[epoch:]pkgver-pkgrel".
+func (pkg Package) FullVersion() (version string) {
+	version = pkg.Version + "-" + pkg.Release
+	if pkg.Epoch != "" && pkg.Epoch != "0" {
+		version = pkg.Epoch + ":" + version
+	}
+	return
+}
+
+// PackageNames returns the names of all (split) packages.
+func (info *SrcInfo) PackageNames() (names []string) {
+	for _, pkg := range info.Packages {
+		names = append(names, pkg.Name)
+	}
+	return
+}
+
+// Section returns the pkgname section called name.
+func (info *SrcInfo) Section(name string) (section *Section, err error) {
+	for i := range info.Packages {
+		if info.Packages[i].Name == name {
+			return &info.Packages[i], nil
+		}
+	}
+	err = errors.New(info.Base.Name + ": no such package: " + name)
+	return
+}
+
+// Package resolves the package called name for arch.
+func (info *SrcInfo) Package(name string, arch string) (pkg Package, err error) {
+	section, err := info.Section(name)
+	if err != nil {
+		return
+	}
+	lookup := func(key string, arch string) []string {
+		if section.Has(key, arch) {
+			return section.Values(key, arch)
+		}
+		return info.Base.Values(key, arch)
+	}
+	// architecture-specific values do not apply to arch=(any) packages
+	if contains(lookup("arch", ""), "any") {
+		arch = ""
+	}
+	values := func(key string) (vs []string) {
+		vs = lookup(key, "")
+		if arch != "" && arch != "any" && IsArchSpecific(key) {
+			vs = append(vs, lookup(key, arch)...)
+		}
+		return
+	}
+	value := func(key string) string {
+		vs := lookup(key, "")
+		if len(vs) == 0 {
+			return ""
+		}
+		return vs[0]
+	}
+	pkg = Package{
+		Base:         info.Base.Name,
+		Name:         name,
+		Version:      info.Base.Value("pkgver"),
+		Release:      info.Base.Value("pkgrel"),
+		Epoch:        info.Base.Value("epoch"),
+		Desc:         value("pkgdesc"),
+		URL:          value("url"),
+		Install:      value("install"),
+		Changelog:    value("changelog"),
+		Arch:         values("arch"),
+		Groups:       values("groups"),
+		License:      values("license"),
+		Backup:       values("backup"),
+		Options:      values("options"),
+		NoExtract:    info.Base.Values("noextract", ""),
+		ValidPGPKeys: info.Base.Values("validpgpkeys", ""),
+		Source:       values("source"),
+		Depends:      values("depends"),
+		MakeDepends:  values("makedepends"),
+		CheckDepends: values("checkdepends"),
+		OptDepends:   values("optdepends"),
+		Provides:     values("provides"),
+		Conflicts:    values("conflicts"),
+		Replaces:     values("replaces"),
+		Sums:         make(map[string][]string),
+	}
+	for _, algorithm := range HashAlgorithms {
+		if sums := values(algorithm + "sums"); len(sums) != 0 {
+			pkg.Sums[algorithm] = sums
+		}
+	}
+	return
+}
+
+// ResolvePackages resolves every package for arch.
+func (info *SrcInfo) ResolvePackages(arch string) (pkgs []Package, err error) {
+	for _, name := range info.PackageNames() {
+		var pkg Package
+		pkg, err = info.Package(name, arch)
+		if err != nil {
+			return
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return
+}
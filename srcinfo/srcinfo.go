@@ -0,0 +1,311 @@
+// Package srcinfo reads and writes .SRCINFO files generated by makepkg --printsrcinfo.
+package srcinfo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// HashAlgorithms lists the checksum arrays known to makepkg, in .SRCINFO order.
+var HashAlgorithms = []string{"ck", "md5", "sha1", "sha224", "sha256", "sha384", "sha512", "b2"}
+
+var baseSingleValued = []string{"pkgdesc", "pkgver", "pkgrel", "epoch", "url", "install", "changelog"}
+var baseMultiValued = append([]string{"arch", "groups", "license", "checkdepends", "makedepends",
+	"depends", "optdepends", "provides", "conflicts", "replaces",
+	"noextract", "options", "backup", "source", "validpgpkeys"}, hashKeys()...)
+var packageSingleValued = []string{"pkgdesc", "url", "install", "changelog"}
+var packageMultiValued = []string{"arch", "groups", "license", "checkdepends", "depends", "optdepends",
+	"provides", "conflicts", "replaces", "options", "backup"}
+var archSpecific = append([]string{"source", "provides", "conflicts", "depends", "replaces",
+	"optdepends", "makedepends", "checkdepends"}, hashKeys()...)
+
+func hashKeys() (keys []string) {
+	for _, algorithm := range HashAlgorithms {
+		keys = append(keys, algorithm+"sums")
+	}
+	return
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// IsArchSpecific reports whether key may have a "_<arch>" suffix (e.g. depends_x86_64).
+func IsArchSpecific(key string) bool {
+	return contains(archSpecific, key)
+}
+
+// Field is a single "key = value" line. Arch is set for keys such as depends_x86_64.
+// A comment line inside a section is kept as a Field with only Comment set.
+type Field struct {
+	Key     string
+	Arch    string
+	Value   string
+	Comment string
+}
+
+// FullKey returns the key as written in the file (e.g. "depends_x86_64").
+func (field Field) FullKey() string {
+	if field.Arch == "" {
+		return field.Key
+	}
+	return field.Key + "_" + field.Arch
+}
+
+// Section is a "pkgbase = ..." or "pkgname = ..." block. Fields keep the order of the file.
+type Section struct {
+	// Comments holds the "# ..." lines right before a pkgname line.
+	Comments []string
+	Name     string
+	Fields   []Field
+}
+
+// Has reports whether the section sets key for arch (even to an empty value).
+func (section Section) Has(key string, arch string) bool {
+	for _, field := range section.Fields {
+		if field.Key == key && field.Arch == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns the non-empty values of key for arch ("" for the architecture-independent key).
+func (section Section) Values(key string, arch string) (values []string) {
+	for _, field := range section.Fields {
+		if field.Key == key && field.Arch == arch && field.Value != "" {
+			values = append(values, field.Value)
+		}
+	}
+	return
+}
+
+// Value returns the first value of key.
+func (section Section) Value(key string) string {
+	values := section.Values(key, "")
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Add appends a field.
+func (section *Section) Add(key string, arch string, value string) {
+	section.Fields = append(section.Fields, Field{Key: key, Arch: arch, Value: value})
+}
+
+// SrcInfo is the content of a .SRCINFO file: a pkgbase and one or more (split) packages.
+type SrcInfo struct {
+	// Comments holds the leading "# ..." lines.
+	Comments []string
+	Base     Section
+	Packages []Section
+}
+
+// ParseError reports a malformed line.
+type ParseError struct {
+	Line int
+	Text string
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s: %q", e.Line, e.Msg, e.Text)
+}
+
+// IsBaseKey reports whether key belongs to the pkgbase section.
+func IsBaseKey(key string) bool {
+	return contains(baseSingleValued, key) || contains(baseMultiValued, key)
+}
+
+// IsPackageKey reports whether key may be overridden in a pkgname section.
+func IsPackageKey(key string) bool {
+	return contains(packageSingleValued, key) || contains(packageMultiValued, key) ||
+		(IsArchSpecific(key) && key != "source" && key != "makedepends" && !contains(hashKeys(), key))
+}
+
+// SplitKey splits "depends_x86_64" into "depends" and "x86_64".
+func SplitKey(fullKey string) (key string, arch string) {
+	key = fullKey
+	if i := strings.Index(fullKey, "_"); i >= 0 && IsArchSpecific(fullKey[:i]) {
+		key, arch = fullKey[:i], fullKey[i+1:]
+	}
+	return
+}
+
+// Parse reads a .SRCINFO.
+func Parse(r io.Reader) (info *SrcInfo, err error) {
+	info = &SrcInfo{}
+	var current *Section
+	// comments are attached to the next line: a section header or a field
+	var comments []string
+	flushComments := func() {
+		for _, comment := range comments {
+			current.Fields = append(current.Fields, Field{Comment: comment})
+		}
+		comments = nil
+	}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		text := scanner.Text()
+		line := strings.TrimSpace(text)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			comments = append(comments, strings.TrimRight(text, " \t\r"))
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			err = &ParseError{Line: lineNo, Text: text, Msg: "expected key = value"}
+			return
+		}
+		key, arch := SplitKey(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		switch key {
+		case "pkgbase":
+			if current != nil {
+				err = &ParseError{Line: lineNo, Text: text, Msg: "pkgbase must come first"}
+				return
+			}
+			info.Comments, comments = comments, nil
+			info.Base.Name = value
+			current = &info.Base
+		case "pkgname":
+			if current == nil {
+				err = &ParseError{Line: lineNo, Text: text, Msg: "pkgname before pkgbase"}
+				return
+			}
+			info.Packages = append(info.Packages, Section{Comments: comments, Name: value})
+			comments = nil
+			current = &info.Packages[len(info.Packages)-1]
+		default:
+			if current == nil {
+				err = &ParseError{Line: lineNo, Text: text, Msg: "field before pkgbase"}
+				return
+			}
+			flushComments()
+			current.Add(key, arch, value)
+		}
+	}
+	if current != nil {
+		flushComments()
+	}
+	err = scanner.Err()
+	if err == nil && len(info.Packages) == 0 {
+		err = &ParseError{Line: lineNo, Msg: "no pkgname"}
+	}
+	return
+}
+
+// ParseFile reads the .SRCINFO at filePath.
+func ParseFile(filePath string) (info *SrcInfo, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	info, err = Parse(file)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", filePath, err)
+	}
+	return
+}
+
+// writeSection writes a section followed by a blank line, like makepkg --printsrcinfo.
+func writeSection(w *bufio.Writer, header string, section Section) {
+	for _, comment := range section.Comments {
+		fmt.Fprintln(w, comment)
+	}
+	fmt.Fprintf(w, "%s = %s\n", header, section.Name)
+	for _, field := range section.Fields {
+		if field.Key == "" && field.Comment != "" {
+			fmt.Fprintln(w, field.Comment)
+			continue
+		}
+		fmt.Fprintf(w, "\t%s = %s\n", field.FullKey(), field.Value)
+	}
+	fmt.Fprintln(w)
+}
+
+// WriteTo writes info in the .SRCINFO format. Fields and comments are written in the order they
+// are stored, so a file written by makepkg round-trips unchanged (apart from blank lines).
+func (info *SrcInfo) WriteTo(w io.Writer) (n int64, err error) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	for _, comment := range info.Comments {
+		fmt.Fprintln(bw, comment)
+	}
+	writeSection(bw, "pkgbase", info.Base)
+	for _, pkg := range info.Packages {
+		writeSection(bw, "pkgname", pkg)
+	}
+	bw.Flush()
+	return buf.WriteTo(w)
+}
+
+// String returns the .SRCINFO text.
+func (info *SrcInfo) String() string {
+	var buf bytes.Buffer
+	info.WriteTo(&buf)
+	return buf.String()
+}
+
+// Sort reorders the fields of every section in the order makepkg writes them.
+func (info *SrcInfo) Sort() {
+	arches := info.Base.Values("arch", "")
+	sortSection(&info.Base, baseSingleValued, baseMultiValued, arches)
+	for i := range info.Packages {
+		pkgArches := arches
+		if info.Packages[i].Has("arch", "") {
+			pkgArches = info.Packages[i].Values("arch", "")
+		}
+		sortSection(&info.Packages[i], packageSingleValued, packageMultiValued, pkgArches)
+	}
+}
+
+func sortSection(section *Section, singleValued []string, multiValued []string, arches []string) {
+	fields := make([]Field, 0, len(section.Fields))
+	used := make([]bool, len(section.Fields))
+	take := func(key string, arch string) {
+		for i, field := range section.Fields {
+			if !used[i] && field.Key == key && field.Arch == arch {
+				fields = append(fields, field)
+				used[i] = true
+			}
+		}
+	}
+	for _, key := range singleValued {
+		take(key, "")
+	}
+	for _, key := range multiValued {
+		take(key, "")
+	}
+	for _, arch := range arches {
+		if arch == "any" {
+			continue
+		}
+		for _, key := range archSpecific {
+			take(key, arch)
+		}
+	}
+	// keep unknown fields at the end
+	for i, field := range section.Fields {
+		if !used[i] {
+			fields = append(fields, field)
+		}
+	}
+	section.Fields = fields
+}
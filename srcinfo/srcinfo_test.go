@@ -0,0 +1,117 @@
+package srcinfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// splitSrcInfo is a split package .SRCINFO as written by makepkg --printsrcinfo (with the header
+// of older makepkg versions and a hand-written comment).
+const splitSrcInfo = `# Generated by makepkg 6.0.2
+# Sun Jan  7 12:00:00 UTC 2024
+pkgbase = zstd-tools
+	pkgdesc = Zstandard - Fast real-time compression algorithm
+	pkgver = 1.5.5
+	pkgrel = 1
+	url = https://facebook.github.io/zstd/
+	arch = x86_64
+	arch = aarch64
+	license = BSD
+	license = GPL2
+	checkdepends = gtest
+	makedepends = cmake
+	makedepends = ninja
+	depends = glibc
+	source = https://github.com/facebook/zstd/releases/download/v1.5.5/zstd-1.5.5.tar.zst
+	source = zstd-1.5.5.tar.zst.sig::https://github.com/facebook/zstd/releases/download/v1.5.5/zstd-1.5.5.tar.zst.sig
+	validpgpkeys = 4EF4AC63455FC9F4545D9B7DEF8FE99528B52FFD
+	sha256sums = ce264bca60eb2f0e99e4508cffd0d4d19dd362e84244d7fc941e79fa69ccf673
+	sha256sums = SKIP
+	# the vendored lz4 only builds on x86_64
+	source_x86_64 = lz4-1.9.4.tar.gz::https://github.com/lz4/lz4/archive/v1.9.4.tar.gz
+	sha256sums_x86_64 = 0b0e3aa07c8c063ddf40b082bdf7e37a1562bda40a0ff5272957f3e987e0e54b
+	makedepends_x86_64 = nasm
+	depends_aarch64 = libatomic
+
+pkgname = zstd-tools
+	depends = glibc
+	depends = zlib
+	depends = xz
+	depends = lz4
+	provides = libzstd.so
+	depends_x86_64 = lib32-glibc
+	optdepends_x86_64 = zstd-tools-avx2: faster decompression
+
+# the static library is built from the same sources
+pkgname = zstd-tools-static
+	pkgdesc = Zstandard static library
+	arch = any
+	depends = zstd-tools=1.5.5
+	options = staticlibs
+	options = !strip
+
+`
+
+func TestParseRoundTrip(t *testing.T) {
+	info, err := Parse(strings.NewReader(splitSrcInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.String(); got != splitSrcInfo {
+		t.Errorf("String() does not round-trip:\n%s\nwant:\n%s", got, splitSrcInfo)
+	}
+	if len(info.Comments) != 2 {
+		t.Errorf("Comments = %q, want the 2 header lines", info.Comments)
+	}
+	if len(info.Packages) != 2 || info.Packages[1].Comments[0] != "# the static library is built from the same sources" {
+		t.Errorf("comment of the second package not kept: %+v", info.Packages)
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	info, err := Parse(strings.NewReader(splitSrcInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		section Section
+		key     string
+		arch    string
+		want    []string
+	}{
+		{info.Base, "arch", "", []string{"x86_64", "aarch64"}},
+		{info.Base, "makedepends", "x86_64", []string{"nasm"}},
+		{info.Base, "depends", "aarch64", []string{"libatomic"}},
+		{info.Base, "sha256sums", "", []string{"ce264bca60eb2f0e99e4508cffd0d4d19dd362e84244d7fc941e79fa69ccf673", "SKIP"}},
+		{info.Packages[0], "depends", "", []string{"glibc", "zlib", "xz", "lz4"}},
+		{info.Packages[0], "depends", "x86_64", []string{"lib32-glibc"}},
+		{info.Packages[0], "optdepends", "x86_64", []string{"zstd-tools-avx2: faster decompression"}},
+		{info.Packages[1], "options", "", []string{"staticlibs", "!strip"}},
+	}
+	for _, tt := range tests {
+		if got := tt.section.Values(tt.key, tt.arch); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Values(%q, %q) = %q, want %q", tt.section.Name, tt.key, tt.arch, got, tt.want)
+		}
+	}
+	if got := info.Base.Value("pkgver"); got != "1.5.5" {
+		t.Errorf("pkgver = %q", got)
+	}
+	if info.Packages[1].Has("depends", "x86_64") {
+		t.Error("zstd-tools-static should not override depends_x86_64")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	inputs := []string{
+		"pkgname = foo\n",
+		"pkgdesc = foo\npkgbase = foo\npkgname = foo\n",
+		"pkgbase = foo\n\tpkgver\npkgname = foo\n",
+		"pkgbase = foo\n\tpkgver = 1\n",
+	}
+	for _, input := range inputs {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Parse(%q) = nil error", input)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package srchway
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SyncDBRepo searches the pacman sync databases (<dbpath>/sync/*.db) instead of a web API,
+// so it works offline and for third-party repositories.
+type SyncDBRepo struct{}
+
+// SyncDB is the content of a sync database.
+type SyncDB struct {
+	Name     string
+	Packages []Package
+}
+
+// ParseSyncDB reads the packages of a sync database (a tar archive of <pkgname>-<pkgver>-<pkgrel>/desc
+// and, in older databases, .../depends; files databases also have .../files) and labels them with
+// the repository repoName.
+func ParseSyncDB(r io.Reader, repoName string) (pkgs []Package, err error) {
+	rc, err := NewDecompressReader(r)
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	entries := make(map[string]map[string][]string)
+	var dirs []string
+	for {
+		var header *tar.Header
+		header, err = tr.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+		dir, file := path.Split(header.Name)
+		if file != "desc" && file != "depends" && file != "files" {
+			continue
+		}
+		var fields map[string][]string
+		fields, err = ParseDesc(tr)
+		if err != nil {
+			return
+		}
+		if entries[dir] == nil {
+			entries[dir] = make(map[string][]string)
+			dirs = append(dirs, dir)
+		}
+		for key, values := range fields {
+			entries[dir][key] = values
+		}
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		pkgs = append(pkgs, DescPackage(repoName, entries[dir]))
+	}
+	return
+}
+
+// ReadSyncDB reads the sync database at dbFilePath; the repository is named after the file.
+func ReadSyncDB(dbFilePath string) (db SyncDB, err error) {
+	file, err := os.Open(dbFilePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	db.Name = strings.TrimSuffix(filepath.Base(dbFilePath), filepath.Ext(dbFilePath))
+	db.Packages, err = ParseSyncDB(file, db.Name)
+	if err != nil {
+		err = errors.New(dbFilePath + ": " + err.Error())
+	}
+	return
+}
+
+// syncDBPaths returns the database files with the extension ext in <dbpath>/sync, official
+// repositories first (in the order of OfficialRepos), then the others alphabetically.
+// If conf.RepoNames is set, only those repositories are returned.
+func syncDBPaths(conf Conf, ext string) (dbFilePaths []string, err error) {
+	dbFilePaths, err = filepath.Glob(filepath.Join(conf.dbPath(), "sync", "*"+ext))
+	if err != nil {
+		return
+	}
+	rank := func(p string) int {
+		name := strings.TrimSuffix(filepath.Base(p), ext)
+		for i, info := range OfficialRepos {
+			if info.Name == name {
+				return i
+			}
+		}
+		return len(OfficialRepos)
+	}
+	sort.SliceStable(dbFilePaths, func(i, j int) bool { return rank(dbFilePaths[i]) < rank(dbFilePaths[j]) })
+	if len(conf.RepoNames) == 0 {
+		return
+	}
+	selected := make(map[string]bool)
+	for _, name := range conf.RepoNames {
+		selected[name] = true
+	}
+	all := dbFilePaths
+	dbFilePaths = nil
+	for _, p := range all {
+		if selected[strings.TrimSuffix(filepath.Base(p), ext)] {
+			dbFilePaths = append(dbFilePaths, p)
+		}
+	}
+	return
+}
+
+// LoadSyncDBs reads the sync databases (<dbpath>/sync/*.db).
+func LoadSyncDBs(conf Conf) (dbs []SyncDB, err error) {
+	dbFilePaths, err := syncDBPaths(conf, ".db")
+	if err != nil {
+		return
+	}
+	if len(dbFilePaths) == 0 {
+		err = errors.New("no sync database in " + filepath.Join(conf.dbPath(), "sync"))
+		return
+	}
+	for _, dbFilePath := range dbFilePaths {
+		var db SyncDB
+		db, err = ReadSyncDB(dbFilePath)
+		if err != nil {
+			return
+		}
+		dbs = append(dbs, db)
+	}
+	return
+}
+
+// syncDBSearchValues returns the values of pkg matched by a search by the field by.
+func syncDBSearchValues(pkg Package, by string) (values []string, err error) {
+	depNames := func(deps []string) (names []string) {
+		for _, dep := range deps {
+			names = append(names, ParseDependency(dep).Name)
+		}
+		return
+	}
+	switch by {
+	case "", "name-desc":
+		values = []string{pkg.Name, pkg.Description}
+	case "name":
+		values = []string{pkg.Name}
+	case "desc":
+		values = []string{pkg.Description}
+	case "depends":
+		values = depNames(pkg.Depends)
+	case "makedepends":
+		values = depNames(pkg.MakeDepends)
+	case "checkdepends":
+		values = depNames(pkg.CheckDepends)
+	case "optdepends":
+		values = depNames(pkg.OptDepends)
+	case "provides":
+		values = depNames(pkg.Provides)
+	case "conflicts":
+		values = depNames(pkg.Conflicts)
+	case "replaces":
+		values = depNames(pkg.Replaces)
+	case "groups":
+		values = pkg.Groups
+	default:
+		err = errors.New("sync databases cannot be searched by " + by)
+	}
+	return
+}
+
+// Search returns the packages matching every word of conf.Args (case-insensitively, like pacman -Ss).
+// Dependency fields are matched by exact package name.
+func (repo SyncDBRepo) Search(conf Conf) (pkgs []Package, err error) {
+	if _, err = syncDBSearchValues(Package{}, conf.SearchBy); err != nil {
+		return
+	}
+	dbs, err := LoadSyncDBs(conf)
+	if err != nil {
+		return
+	}
+	pkgs = make([]Package, 0)
+	exact := conf.SearchBy != "" && conf.SearchBy != "name-desc" && conf.SearchBy != "name" && conf.SearchBy != "desc"
+	for _, db := range dbs {
+		for _, pkg := range db.Packages {
+			values, _ := syncDBSearchValues(pkg, conf.SearchBy)
+			if matchesAll(values, conf.Args, exact) {
+				pkgs = append(pkgs, pkg)
+			}
+		}
+	}
+	return
+}
+
+func matchesAll(values []string, words []string, exact bool) bool {
+	for _, word := range words {
+		found := false
+		for _, value := range values {
+			if exact && value == word || !exact && strings.Contains(strings.ToLower(value), strings.ToLower(word)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Info returns the package conf.Args[0] ("name" or "repo/name") from the first database containing it.
+func (repo SyncDBRepo) Info(conf Conf) (pkg Package, err error) {
+	if len(conf.Args) == 0 {
+		err = errors.New("please specify package name")
+		return
+	}
+	repoName, name := "", conf.Args[0]
+	if i := strings.Index(name, "/"); i >= 0 {
+		repoName, name = CanonicalRepoName(name[:i]), name[i+1:]
+	}
+	dbs, err := LoadSyncDBs(conf)
+	if err != nil {
+		return
+	}
+	for _, db := range dbs {
+		if repoName != "" && db.Name != repoName {
+			continue
+		}
+		for _, p := range db.Packages {
+			if p.Name == name {
+				return p, nil
+			}
+		}
+	}
+	err = ErrNotFound
+	return
+}
+
+// Get downloads the packaging files from the official packaging repositories,
+// as sync databases do not contain them.
+func (repo SyncDBRepo) Get(conf Conf) (newOutFilePath string, err error) {
+	newOutFilePath, err = OfficialRepo{}.Get(conf)
+	return
+}
@@ -0,0 +1,68 @@
+package srchway
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseRepoList(t *testing.T) {
+	names, err := ParseRepoList("core, community,Extra,chaotic-aur,extra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"core", "extra", "chaotic-aur"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ParseRepoList() = %q, want %q", names, want)
+	}
+	if _, err := ParseRepoList(" ,"); err == nil {
+		t.Error("ParseRepoList(\" ,\") = nil error")
+	}
+
+	conf := Conf{Operation: OperationTypeSearch, RepoNames: names}
+	if err := conf.CheckRepoNames(); err == nil {
+		t.Error("CheckRepoNames() with a third-party repository and the web API = nil error")
+	}
+	conf.SyncDBFlag = true
+	if err := conf.CheckRepoNames(); err != nil {
+		t.Errorf("CheckRepoNames() with the sync databases = %v", err)
+	}
+	conf = Conf{Operation: OperationTypeFiles, RepoNames: names}
+	if err := conf.CheckRepoNames(); err != nil {
+		t.Errorf("CheckRepoNames() with the files databases = %v", err)
+	}
+}
+
+func TestSyncDBRepoNames(t *testing.T) {
+	dbPath := t.TempDir()
+	writeSyncDB(t, dbPath, "extra", map[string][]string{"NAME": {"python-six"}, "VERSION": {"1.16.0-8"}})
+	writeSyncDB(t, dbPath, "myrepo", map[string][]string{"NAME": {"python-six"}, "VERSION": {"1.17.0-1"}})
+
+	tests := []struct {
+		repoNames []string
+		arg       string
+		want      string
+	}{
+		{nil, "python-six", "extra"},
+		{nil, "community/python-six", "extra"},
+		{nil, "myrepo/python-six", "myrepo"},
+		{[]string{"myrepo"}, "python-six", "myrepo"},
+	}
+	for _, tt := range tests {
+		conf := Conf{DBPath: dbPath, SyncDBFlag: true, RepoNames: tt.repoNames, Args: []string{tt.arg}}
+		pkg, err := SyncDBRepo{}.Info(conf)
+		if err != nil || pkg.Repo != tt.want {
+			t.Errorf("Info(%q) with --repo %q = %s, %v, want %s", tt.arg, tt.repoNames, pkg.Repo, err, tt.want)
+		}
+	}
+
+	// the files databases have the same layout
+	syncDir := filepath.Join(dbPath, "sync")
+	if err := os.Rename(filepath.Join(syncDir, "extra.db"), filepath.Join(syncDir, "extra.files")); err != nil {
+		t.Fatal(err)
+	}
+	list, err := ListFiles(Conf{DBPath: dbPath, SyncDBFlag: true, Args: []string{"community/python-six"}})
+	if err != nil || list.Repo != "extra" {
+		t.Errorf("ListFiles(community/python-six) = %s, %v, want extra", list.Repo, err)
+	}
+}
@@ -2,9 +2,9 @@ package srchway
 
 import (
 	"errors"
+	"io/ioutil"
+	"net/http"
 	"net/url"
-	"os"
-	"path"
 	"strings"
 )
 
@@ -47,25 +47,48 @@ func joinOrNoneStringForOptDepends(ss []string) (s string) {
 	return
 }
 
-func createOutFile(outFilePath string, url string) (file *os.File, newOutFilePath string, err error) {
-	if outFilePath == "" {
-		outFilePath = path.Base(url)
-	}
-	fi, err := os.Stat(outFilePath)
-	switch {
-	case err != nil:
-		// how to handle err? (through)
-		file, err = os.Create(outFilePath)
-		if err == nil {
-			newOutFilePath = outFilePath
-		}
+// HTTPStatusError is returned when a server responds with a status other than 200 OK.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return e.URL + ": " + e.Status
+}
+
+// ErrNotFound is returned when a package does not exist.
+var ErrNotFound = errors.New("not found")
+
+// IsNotFound reports whether err means that a package does not exist (as opposed to a network error).
+func IsNotFound(err error) bool {
+	var statusErr *HTTPStatusError
+	return errors.Is(err, ErrNotFound) || errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+func httpGetResponse(conf Conf, url string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(conf.context(), http.MethodGet, url, nil)
+	if err != nil {
 		return
-	case fi.IsDir():
-		outFilePath2 := outFilePath + "/" + path.Base(url)
-		file, newOutFilePath, err = createOutFile(outFilePath2, url)
+	}
+	resp, err = conf.Client().Do(req)
+	if err != nil {
 		return
-	default:
-		err = errors.New("file exists")
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = &HTTPStatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return
+}
+
+func httpGet(conf Conf, url string) (bytes []byte, err error) {
+	resp, err := httpGetResponse(conf, url)
+	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
+	bytes, err = ioutil.ReadAll(resp.Body)
+	return
 }
@@ -0,0 +1,213 @@
+package srchway
+
+import "strings"
+
+// Port of libalpm's version comparison (lib/libalpm/version.c).
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || isAlpha(c)
+}
+
+// parseEVR splits "[epoch:]version[-release]"; release is "" if absent.
+func parseEVR(evr string) (epoch string, version string, release string, hasRelease bool) {
+	s := 0
+	for s < len(evr) && isDigit(evr[s]) {
+		s++
+	}
+	version = evr
+	epoch = "0"
+	if s < len(evr) && evr[s] == ':' {
+		if s != 0 {
+			epoch = evr[:s]
+		}
+		version = evr[s+1:]
+	}
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		version, release, hasRelease = version[:i], version[i+1:], true
+	}
+	return
+}
+
+// rpmvercmp compares two version segments the way rpm and pacman do.
+func rpmvercmp(a string, b string) int {
+	if a == b {
+		return 0
+	}
+	one, two := 0, 0
+	for one < len(a) && two < len(b) {
+		ptr1, ptr2 := one, two
+		for one < len(a) && !isAlnum(a[one]) {
+			one++
+		}
+		for two < len(b) && !isAlnum(b[two]) {
+			two++
+		}
+		// if we ran to the end of either, we are finished with the loop
+		if one >= len(a) || two >= len(b) {
+			break
+		}
+		// if the separator lengths were different, we are also finished
+		if one-ptr1 != two-ptr2 {
+			if one-ptr1 < two-ptr2 {
+				return -1
+			}
+			return 1
+		}
+		ptr1, ptr2 = one, two
+		// grab first completely alpha or completely numeric segment
+		isNum := isDigit(a[ptr1])
+		if isNum {
+			for ptr1 < len(a) && isDigit(a[ptr1]) {
+				ptr1++
+			}
+			for ptr2 < len(b) && isDigit(b[ptr2]) {
+				ptr2++
+			}
+		} else {
+			for ptr1 < len(a) && isAlpha(a[ptr1]) {
+				ptr1++
+			}
+			for ptr2 < len(b) && isAlpha(b[ptr2]) {
+				ptr2++
+			}
+		}
+		// numeric segments are always newer than alpha segments
+		if two == ptr2 {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+		seg1, seg2 := a[one:ptr1], b[two:ptr2]
+		if isNum {
+			// whichever number has more digits wins
+			seg1 = strings.TrimLeft(seg1, "0")
+			seg2 = strings.TrimLeft(seg2, "0")
+			if len(seg1) > len(seg2) {
+				return 1
+			}
+			if len(seg2) > len(seg1) {
+				return -1
+			}
+		}
+		if c := strings.Compare(seg1, seg2); c != 0 {
+			return c
+		}
+		one, two = ptr1, ptr2
+	}
+	// all segments compared identically but the separators were different
+	if one >= len(a) && two >= len(b) {
+		return 0
+	}
+	// the final showdown: a remaining alpha string never beats an empty string
+	if (one >= len(a) && !isAlpha(b[two])) || (one < len(a) && isAlpha(a[one])) {
+		return -1
+	}
+	return 1
+}
+
+// VerCmp compares two "[epoch:]pkgver[-pkgrel]" strings like pacman's alpm_pkg_vercmp (and vercmp(8)).
+// It returns -1, 0 or 1. The pkgrel is only compared if both versions have one.
+func VerCmp(a string, b string) int {
+	if a == b {
+		return 0
+	}
+	epoch1, ver1, rel1, hasRel1 := parseEVR(a)
+	epoch2, ver2, rel2, hasRel2 := parseEVR(b)
+	ret := rpmvercmp(epoch1, epoch2)
+	if ret == 0 {
+		ret = rpmvercmp(ver1, ver2)
+		if ret == 0 && hasRel1 && hasRel2 {
+			ret = rpmvercmp(rel1, rel2)
+		}
+	}
+	return ret
+}
+
+// Dependency is a parsed dependency string such as "foo>=1.2-3", "foo=1:2" or "foo: description".
+type Dependency struct {
+	Name    string
+	Op      string
+	Version string
+	Desc    string
+}
+
+// DependencyOps lists the version constraint operators, longest first.
+var DependencyOps = []string{">=", "<=", "=", ">", "<"}
+
+// ParseDependency parses a depends/provides/optdepends entry like alpm_dep_from_string.
+func ParseDependency(s string) (dep Dependency) {
+	// optdepends carry a description ("foo: for bar")
+	if i := strings.Index(s, ": "); i >= 0 {
+		s, dep.Desc = s[:i], s[i+2:]
+	}
+	i := strings.IndexAny(s, "<>=")
+	if i < 0 {
+		dep.Name = s
+		return
+	}
+	dep.Name = s[:i]
+	for _, op := range DependencyOps {
+		if strings.HasPrefix(s[i:], op) {
+			dep.Op = op
+			dep.Version = s[i+len(op):]
+			break
+		}
+	}
+	return
+}
+
+func (dep Dependency) String() (s string) {
+	s = dep.Name + dep.Op + dep.Version
+	if dep.Desc != "" {
+		s += ": " + dep.Desc
+	}
+	return
+}
+
+// SatisfiedByVersion reports whether version meets the constraint of dep.
+func (dep Dependency) SatisfiedByVersion(version string) bool {
+	if dep.Op == "" {
+		return true
+	}
+	if version == "" {
+		return false
+	}
+	c := VerCmp(version, dep.Version)
+	switch dep.Op {
+	case "=":
+		return c == 0
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case "<":
+		return c < 0
+	}
+	return false
+}
+
+// SatisfiedBy reports whether pkg satisfies dep by its name or by one of its provides.
+// An unversioned provide only satisfies an unversioned dependency.
+func (dep Dependency) SatisfiedBy(pkg Package) bool {
+	if pkg.Name == dep.Name && dep.SatisfiedByVersion(pkg.Version) {
+		return true
+	}
+	for _, provide := range pkg.Provides {
+		p := ParseDependency(provide)
+		if p.Name == dep.Name && dep.SatisfiedByVersion(p.Version) {
+			return true
+		}
+	}
+	return false
+}
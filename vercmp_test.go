@@ -0,0 +1,159 @@
+package srchway
+
+import (
+	"reflect"
+	"testing"
+)
+
+// vercmpTests are the cases of pacman's test/util/vercmptest.sh.
+var vercmpTests = []struct {
+	a, b string
+	want int
+}{
+	// all similar length, no pkgrel
+	{"1.5.0", "1.5.0", 0},
+	{"1.5.1", "1.5.0", 1},
+
+	// mixed length
+	{"1.5.1", "1.5", 1},
+
+	// with pkgrel, simple
+	{"1.5.0-1", "1.5.0-1", 0},
+	{"1.5.0-1", "1.5.0-2", -1},
+	{"1.5.0-1", "1.5.1-1", -1},
+	{"1.5.0-2", "1.5.1-1", -1},
+
+	// with pkgrel, mixed lengths
+	{"1.5-1", "1.5.1-1", -1},
+	{"1.5-2", "1.5.1-1", -1},
+	{"1.5-2", "1.5.1-2", -1},
+
+	// mixed pkgrel inclusion
+	{"1.5", "1.5-1", 0},
+	{"1.5-1", "1.5", 0},
+	{"1.1-1", "1.1", 0},
+	{"1.0-1", "1.1", -1},
+	{"1.1-1", "1.0", 1},
+
+	// alphanumeric versions
+	{"1.5b-1", "1.5-1", -1},
+	{"1.5b", "1.5", -1},
+	{"1.5b-1", "1.5", -1},
+	{"1.5b", "1.5.1", -1},
+
+	// from the manpage
+	{"1.0a", "1.0alpha", -1},
+	{"1.0alpha", "1.0b", -1},
+	{"1.0b", "1.0beta", -1},
+	{"1.0beta", "1.0rc", -1},
+	{"1.0rc", "1.0", -1},
+
+	// going crazy? alpha-dotted versions
+	{"1.5.a", "1.5", 1},
+	{"1.5.b", "1.5.a", 1},
+	{"1.5.1", "1.5.b", 1},
+
+	// alpha dots and dashes
+	{"1.5.b-1", "1.5.b", 0},
+	{"1.5-1", "1.5.b", -1},
+
+	// same/similar content, differing separators
+	{"2.0", "2_0", 0},
+	{"2.0_a", "2_0.a", 0},
+	{"2.0a", "2.0.a", -1},
+	{"2___a", "2_a", 1},
+
+	// epoch included version comparisons
+	{"0:1.0", "0:1.0", 0},
+	{"0:1.0", "0:1.1", -1},
+	{"1:1.0", "0:1.0", 1},
+	{"1:1.0", "0:1.1", 1},
+	{"1:1.0", "2:1.1", -1},
+
+	// epoch + sometimes present pkgrel
+	{"1:1.0", "0:1.0-1", 1},
+	{"1:1.0-1", "0:1.1-1", 1},
+
+	// epoch included on one version
+	{"0:1.0", "1.0", 0},
+	{"0:1.0", "1.1", -1},
+	{"0:1.1", "1.0", 1},
+	{"1:1.0", "1.0", 1},
+	{"1:1.0", "1.1", 1},
+	{"1:1.1", "1.1", 1},
+}
+
+func TestVerCmp(t *testing.T) {
+	for _, tt := range vercmpTests {
+		// like vercmptest.sh, check both directions
+		if got := VerCmp(tt.a, tt.b); got != tt.want {
+			t.Errorf("VerCmp(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := VerCmp(tt.b, tt.a); got != -tt.want {
+			t.Errorf("VerCmp(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestParseDependency(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Dependency
+	}{
+		{"glibc", Dependency{Name: "glibc"}},
+		{"python>=3.11", Dependency{Name: "python", Op: ">=", Version: "3.11"}},
+		{"python<=3.12", Dependency{Name: "python", Op: "<=", Version: "3.12"}},
+		{"libreadline.so=8-64", Dependency{Name: "libreadline.so", Op: "=", Version: "8-64"}},
+		{"foo>1:2.0-1", Dependency{Name: "foo", Op: ">", Version: "1:2.0-1"}},
+		{"foo<2", Dependency{Name: "foo", Op: "<", Version: "2"}},
+		{"python-pygments: syntax highlighting", Dependency{Name: "python-pygments", Desc: "syntax highlighting"}},
+		{"qt6-base>=6.5: GUI", Dependency{Name: "qt6-base", Op: ">=", Version: "6.5", Desc: "GUI"}},
+	}
+	for _, tt := range tests {
+		got := ParseDependency(tt.s)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseDependency(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+		if got.String() != tt.s {
+			t.Errorf("ParseDependency(%q).String() = %q", tt.s, got.String())
+		}
+	}
+}
+
+func TestSatisfiedBy(t *testing.T) {
+	bash := Package{Name: "bash", Version: "5.2.026-2", Provides: []string{"sh"}}
+	readline := Package{Name: "readline", Version: "8.2.010-1", Provides: []string{"libreadline.so=8-64"}}
+	python := Package{Name: "python", Version: "3.12.1-1"}
+	epoch := Package{Name: "foo", Version: "1:1.0-1"}
+	tests := []struct {
+		dep  string
+		pkg  Package
+		want bool
+	}{
+		{"bash", bash, true},
+		{"bash>=5", bash, true},
+		{"bash<5", bash, false},
+		{"bash=5.2.026-2", bash, true},
+		{"bash=5.2.026", bash, true},
+		{"bash=5.2.026-1", bash, false},
+		{"sh", bash, true},
+		// an unversioned provide does not satisfy a versioned dependency
+		{"sh>=1", bash, false},
+		{"libreadline.so=8-64", readline, true},
+		{"libreadline.so>=8-64", readline, true},
+		{"libreadline.so=7-64", readline, false},
+		{"python>=3.11", python, true},
+		{"python>3.12.1", python, false},
+		{"python<3.12.1", python, false},
+		{"python>3.12", python, true},
+		{"python3", python, false},
+		{"foo>2.0", epoch, true},
+		{"foo<1:1.0", epoch, false},
+		{"foo=1:1.0", epoch, true},
+	}
+	for _, tt := range tests {
+		if got := ParseDependency(tt.dep).SatisfiedBy(tt.pkg); got != tt.want {
+			t.Errorf("%q SatisfiedBy %s %s = %v, want %v", tt.dep, tt.pkg.Name, tt.pkg.Version, got, tt.want)
+		}
+	}
+}